@@ -0,0 +1,206 @@
+package glfont
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+// Initial size of a glyph atlas in pixels. The width stays fixed, the height
+// doubles whenever a glyph no longer fits.
+const (
+	atlasWidth  = 1024
+	atlasHeight = 256
+)
+
+// atlas packs glyph coverage images into a single channel texture, row by row (shelf packing).
+// Color atlases hold premultiplied RGBA glyph bitmaps instead.
+type atlas struct {
+	texture uint32      // ID handle of the atlas texture
+	img     draw.Image  // copy of the texture, used to upload it again after growing
+	rgba    bool        // the texture holds RGBA pixels instead of coverage
+	padding int         // transparent pixels kept around each image, so filtering does not bleed into neighbours
+	x       int         // pen position on the current shelf
+	y       int         // top of the current shelf
+	shelf   int         // height of the current shelf
+	solid   image.Point // center of an opaque block, for drawing lines
+	min     int32       // minifying texture filter
+	mag     int32       // magnifying texture filter
+	mipmaps bool        // generate mipmaps for text drawn smaller than rasterized
+}
+
+// newAtlas creates an empty atlas texture with padding pixels around each glyph.
+func newAtlas(padding int) *atlas {
+	return newAtlasOf(false, padding)
+}
+
+// newColorAtlas creates an empty atlas texture for color glyph bitmaps.
+func newColorAtlas(padding int) *atlas {
+	return newAtlasOf(true, padding)
+}
+
+// newAtlasOf creates an empty coverage or RGBA atlas texture.
+func newAtlasOf(rgba bool, padding int) *atlas {
+	a := &atlas{
+		rgba:    rgba,
+		padding: padding,
+		min:     gl.LINEAR,
+		mag:     gl.LINEAR,
+	}
+	a.img = a.newImage(atlasWidth, atlasHeight)
+
+	gl.GenTextures(1, &a.texture)
+	gl.BindTexture(gl.TEXTURE_2D, a.texture)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	a.applyFilter()
+	a.upload()
+
+	// an opaque block lets lines, like underlines, be drawn from the same texture
+	block := image.NewAlpha(image.Rect(0, 0, 3, 3))
+	draw.Draw(block, block.Rect, image.Opaque, image.Point{}, draw.Src)
+	x, y, _ := a.add(block)
+	a.solid = image.Pt(x+1, y+1)
+
+	return a
+}
+
+// setFilter changes the texture filters used when glyphs are drawn smaller or larger than rasterized.
+// The atlas texture must be bound.
+func (a *atlas) setFilter(min, mag int32) {
+	a.min, a.mag = min, mag
+	a.applyFilter()
+}
+
+// setMipmaps turns mipmaps on or off. The atlas texture must be bound.
+func (a *atlas) setMipmaps(enabled bool) {
+	a.mipmaps = enabled
+	a.applyFilter()
+	a.updateMipmaps()
+}
+
+// applyFilter sets the texture filters on the bound atlas texture.
+func (a *atlas) applyFilter() {
+	min := a.min
+	if a.mipmaps {
+		min = gl.LINEAR_MIPMAP_LINEAR
+	}
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, min)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, a.mag)
+}
+
+// updateMipmaps regenerates the mipmaps of the bound atlas texture after glyphs were added.
+// The atlas sides are powers of two, so every level halves evenly.
+func (a *atlas) updateMipmaps() {
+	if a.mipmaps {
+		gl.GenerateMipmap(gl.TEXTURE_2D)
+	}
+}
+
+// size returns the atlas dimensions in pixels.
+func (a *atlas) size() (w, h int) {
+	return a.img.Bounds().Dx(), a.img.Bounds().Dy()
+}
+
+// newImage returns an empty image in the pixel format of the texture.
+func (a *atlas) newImage(w, h int) draw.Image {
+	if a.rgba {
+		return image.NewRGBA(image.Rect(0, 0, w, h))
+	}
+	return image.NewAlpha(image.Rect(0, 0, w, h))
+}
+
+// texImage returns the pixels of an image made by newImage with their OpenGL format.
+func (a *atlas) texImage(img draw.Image) (pix []uint8, internalFormat int32, format uint32) {
+	if a.rgba {
+		return img.(*image.RGBA).Pix, gl.RGBA8, gl.RGBA
+	}
+	return img.(*image.Alpha).Pix, gl.R8, gl.RED
+}
+
+// solidUV returns texture coordinates in the middle of the opaque block.
+func (a *atlas) solidUV() (u, v float32) {
+	w, h := a.size()
+	return (float32(a.solid.X) + 0.5) / float32(w), (float32(a.solid.Y) + 0.5) / float32(h)
+}
+
+// add copies a glyph image into the atlas and returns its position.
+// The atlas texture must be bound. When the atlas has to grow its height
+// changes, which invalidates the v coordinates handed out before.
+func (a *atlas) add(glyph image.Image) (x, y int, err error) {
+	w, h := glyph.Bounds().Dx(), glyph.Bounds().Dy()
+	// the space taken including the padding on both sides
+	pw, ph := w+2*a.padding, h+2*a.padding
+	aw, _ := a.size()
+	if pw > aw {
+		return 0, 0, fmt.Errorf("glyph of width %d does not fit the atlas", w)
+	}
+
+	// start a new shelf when the current one is full
+	if a.x+pw > aw {
+		a.x = 0
+		a.y += a.shelf
+		a.shelf = 0
+	}
+
+	// make room below the last shelf
+	for a.y+ph > a.img.Bounds().Dy() {
+		if err := a.grow(); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	x, y = a.x+a.padding, a.y+a.padding
+	dst := image.Rect(x, y, x+w, y+h)
+	draw.Draw(a.img, dst, glyph, glyph.Bounds().Min, draw.Src)
+
+	// upload the glyph in the pixel format of the texture
+	tile := a.newImage(w, h)
+	draw.Draw(tile, tile.Bounds(), glyph, glyph.Bounds().Min, draw.Src)
+	pix, _, format := a.texImage(tile)
+	// rows of one byte per pixel are not 4 byte aligned, callers restore the alignment with textureState
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
+	gl.TexSubImage2D(gl.TEXTURE_2D, 0, int32(x), int32(y), int32(w), int32(h),
+		format, gl.UNSIGNED_BYTE, gl.Ptr(pix))
+
+	a.x += pw
+	if ph > a.shelf {
+		a.shelf = ph
+	}
+	return x, y, nil
+}
+
+// grow doubles the atlas height and uploads the whole image again.
+func (a *atlas) grow() error {
+	var maxSize int32
+	gl.GetIntegerv(gl.MAX_TEXTURE_SIZE, &maxSize)
+
+	width, height := a.size()
+	height *= 2
+	if height > int(maxSize) {
+		return fmt.Errorf("glyph atlas exceeds the maximum texture size %d", maxSize)
+	}
+
+	img := a.newImage(width, height)
+	draw.Draw(img, a.img.Bounds(), a.img, image.Point{}, draw.Src)
+	a.img = img
+	a.upload()
+	return nil
+}
+
+// upload sends the whole atlas image to the bound texture, leaving the unpack alignment at 1 like add.
+func (a *atlas) upload() {
+	w, h := a.size()
+	pix, internalFormat, format := a.texImage(a.img)
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, internalFormat, int32(w), int32(h), 0,
+		format, gl.UNSIGNED_BYTE, gl.Ptr(pix))
+}
+
+// release deletes the atlas texture.
+func (a *atlas) release() {
+	gl.DeleteTextures(1, &a.texture)
+	a.texture = 0
+}
@@ -0,0 +1,47 @@
+package glfont
+
+import (
+	"fmt"
+
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+// buffers is the vertex array and buffer a font draws its quads from, shared by fonts set up with ShareBuffers.
+type buffers struct {
+	vao     uint32
+	vbo     uint32
+	vboSize int // Capacity of the vbo in bytes.
+	users   int // Fonts drawing from the buffers, they are deleted with the last one.
+}
+
+// ShareBuffers makes the font draw from the vertex array and buffer of other instead of its own,
+// so applications with many fonts need only one set of buffer objects and fewer binding changes.
+// The quads of all fonts have the same layout, but the attribute locations of the programs must match,
+// otherwise an error is returned and the font keeps its buffers. The buffers are deleted when the last
+// font using them is released. Setting another program with SetProgram gives the font buffers of its own again.
+func (f *Font) ShareBuffers(other *Font) error {
+	if f.buffers == other.buffers {
+		return nil
+	}
+
+	for _, name := range []string{"vert\x00", "vertTexCoord\x00"} {
+		if gl.GetAttribLocation(f.program, gl.Str(name)) != gl.GetAttribLocation(other.program, gl.Str(name)) {
+			return fmt.Errorf("attribute %s of the programs is at different locations", name[:len(name)-1])
+		}
+	}
+
+	f.releaseBuffers()
+	f.buffers = other.buffers
+	f.users++
+	return nil
+}
+
+// releaseBuffers stops the font drawing from its buffers, deleting them if no other font uses them.
+func (f *Font) releaseBuffers() {
+	f.users--
+	if f.users == 0 {
+		gl.DeleteBuffers(1, &f.vbo)
+		gl.DeleteVertexArrays(1, &f.vao)
+	}
+	f.buffers = nil
+}
@@ -0,0 +1,75 @@
+package glfont
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// LoadTrueTypeFontCollection loads the font at index of a TrueType collection (.ttc),
+// like LoadTrueTypeFont loads a single font. Index 0 is the first font, a single font file
+// only has index 0.
+func LoadTrueTypeFontCollection(program uint32, r io.Reader, index int, scale int32, low, high rune, dir Direction) (*Font, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = collectionFont(data, index)
+	if err != nil {
+		return nil, err
+	}
+	return LoadTrueTypeFont(program, bytes.NewReader(data), scale, low, high, dir)
+}
+
+// collectionFont copies the font at index out of collection data into a font file of its own,
+// the truetype package only reads the first font of a collection.
+func collectionFont(data []byte, index int) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "ttcf" {
+		if index != 0 {
+			return nil, fmt.Errorf("font index %d out of range, the data is a single font", index)
+		}
+		return data, nil
+	}
+
+	numFonts := int(binary.BigEndian.Uint32(data[8:]))
+	if index < 0 || index >= numFonts {
+		return nil, fmt.Errorf("font index %d out of range, the collection holds %d fonts", index, numFonts)
+	}
+	if 12+4*numFonts > len(data) {
+		return nil, fmt.Errorf("font collection offset table is too short")
+	}
+
+	// the offset table of the font and the table records following it
+	offset := int(binary.BigEndian.Uint32(data[12+4*index:]))
+	if offset < 0 || offset+12 > len(data) {
+		return nil, fmt.Errorf("bad offset of font %d in the collection", index)
+	}
+	numTables := int(binary.BigEndian.Uint16(data[offset+4:]))
+	header := 12 + 16*numTables
+	if offset+header > len(data) {
+		return nil, fmt.Errorf("table records of font %d are too short", index)
+	}
+
+	font := make([]byte, header, len(data))
+	copy(font, data[offset:offset+header])
+
+	// append each table, 4 byte aligned, and point its record at the copy
+	for i := 0; i < numTables; i++ {
+		record := font[12+16*i:]
+		start := int(binary.BigEndian.Uint32(record[8:]))
+		length := int(binary.BigEndian.Uint32(record[12:]))
+		if start < 0 || length < 0 || start+length > len(data) {
+			return nil, fmt.Errorf("table %q of font %d is out of bounds", record[:4], index)
+		}
+
+		binary.BigEndian.PutUint32(record[8:], uint32(len(font)))
+		font = append(font, data[start:start+length]...)
+		for len(font)%4 != 0 {
+			font = append(font, 0)
+		}
+	}
+	return font, nil
+}
@@ -0,0 +1,367 @@
+package glfont
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"math"
+
+	"github.com/go-gl/gl/all-core/gl"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font/sfnt"
+)
+
+// colorBitmaps reads the color glyph bitmaps embedded in a font, like emoji,
+// from its sbix table or its CBLC and CBDT tables. Only PNG bitmaps are read.
+type colorBitmaps struct {
+	sbix      []byte
+	cblc      []byte
+	cbdt      []byte
+	numGlyphs int
+}
+
+// colorBitmap is a glyph bitmap with its placement in pixels of the strike it was read from.
+type colorBitmap struct {
+	img      image.Image
+	ppem     int // pixels per em of the strike
+	bearingH int // left edge of the bitmap right of the pen
+	bearingV int // top edge of the bitmap above the baseline
+}
+
+// parseColorBitmaps returns the color bitmaps of the font data, nil if it has none.
+func parseColorBitmaps(data []byte, sf *sfnt.Font) *colorBitmaps {
+	c := &colorBitmaps{
+		sbix:      findTable(data, "sbix"),
+		cblc:      findTable(data, "CBLC"),
+		cbdt:      findTable(data, "CBDT"),
+		numGlyphs: sf.NumGlyphs(),
+	}
+	if c.sbix == nil && (c.cblc == nil || c.cbdt == nil) {
+		return nil
+	}
+	return c
+}
+
+// glyph returns the bitmap of a glyph from the strike closest to ppem pixels per em,
+// preferring larger strikes so bitmaps are scaled down.
+func (c *colorBitmaps) glyph(index sfnt.GlyphIndex, ppem float64) (colorBitmap, bool) {
+	if c.sbix != nil {
+		if bm, ok := c.sbixGlyph(int(index), ppem); ok {
+			return bm, true
+		}
+	}
+	if c.cblc != nil && c.cbdt != nil {
+		return c.cbdtGlyph(int(index), ppem)
+	}
+	return colorBitmap{}, false
+}
+
+// closestStrike returns the index of the smallest size of at least ppem, or of the largest size
+// if all are smaller, -1 if there are none.
+func closestStrike(sizes []int, ppem float64) int {
+	best := -1
+	for i, size := range sizes {
+		if float64(size) >= ppem && (best < 0 || size < sizes[best]) {
+			best = i
+		}
+	}
+	if best >= 0 {
+		return best
+	}
+	for i, size := range sizes {
+		if best < 0 || size > sizes[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+// sbixGlyph reads a glyph bitmap from the sbix table.
+func (c *colorBitmaps) sbixGlyph(index int, ppem float64) (colorBitmap, bool) {
+	r := tableReader{b: c.sbix}
+	numStrikes := r.u32(4)
+
+	var sizes, offsets []int
+	for i := 0; i < numStrikes && !r.bad; i++ {
+		offset := r.u32(8 + 4*i)
+		sizes = append(sizes, r.u16(offset))
+		offsets = append(offsets, offset)
+	}
+	strike := closestStrike(sizes, ppem)
+	if r.bad || strike < 0 || index >= c.numGlyphs {
+		return colorBitmap{}, false
+	}
+
+	// glyph data runs from its offset to the offset of the next glyph
+	offset := offsets[strike]
+	start := offset + r.u32(offset+4+4*index)
+	end := offset + r.u32(offset+4+4*(index+1))
+	if r.bad || end-start <= 8 {
+		return colorBitmap{}, false
+	}
+
+	originX, originY := r.i16(start), r.i16(start+2)
+	if string(r.bytes(start+4, 4)) != "png " {
+		return colorBitmap{}, false
+	}
+	img, ok := decodePNG(r.bytes(start+8, end-start-8))
+	if r.bad || !ok {
+		return colorBitmap{}, false
+	}
+
+	// the origin is the bottom left corner of the bitmap
+	return colorBitmap{
+		img:      img,
+		ppem:     sizes[strike],
+		bearingH: originX,
+		bearingV: originY + img.Bounds().Dy(),
+	}, true
+}
+
+// cbdtGlyph reads a glyph bitmap located by the CBLC table from the CBDT table.
+func (c *colorBitmaps) cbdtGlyph(index int, ppem float64) (colorBitmap, bool) {
+	r := tableReader{b: c.cblc}
+	numSizes := r.u32(4)
+
+	// bitmap size records of 48 bytes, the strike covering the glyph closest to ppem
+	var sizes, records []int
+	for i := 0; i < numSizes && !r.bad; i++ {
+		record := 8 + 48*i
+		if index < r.u16(record+40) || index > r.u16(record+42) {
+			continue
+		}
+		sizes = append(sizes, r.u8(record+45))
+		records = append(records, record)
+	}
+	strike := closestStrike(sizes, ppem)
+	if r.bad || strike < 0 {
+		return colorBitmap{}, false
+	}
+
+	record := records[strike]
+	arrayOffset := r.u32(record)
+	numSubtables := r.u32(record + 8)
+
+	for i := 0; i < numSubtables && !r.bad; i++ {
+		entry := arrayOffset + 8*i
+		first, last := r.u16(entry), r.u16(entry+2)
+		if index < first || index > last {
+			continue
+		}
+
+		subtable := arrayOffset + r.u32(entry+4)
+		indexFormat, imageFormat := r.u16(subtable), r.u16(subtable+2)
+		imageOffset := r.u32(subtable + 4)
+
+		// the glyph's offset into CBDT and the big glyph metrics shared by the subtable, if any
+		offset, metrics := -1, -1
+		switch indexFormat {
+		case 1:
+			offset = imageOffset + r.u32(subtable+8+4*(index-first))
+		case 2:
+			offset = imageOffset + r.u32(subtable+8)*(index-first)
+			metrics = subtable + 12
+		case 3:
+			offset = imageOffset + r.u16(subtable+8+2*(index-first))
+		case 4:
+			numGlyphs := r.u32(subtable + 8)
+			for g := 0; g < numGlyphs && !r.bad; g++ {
+				if r.u16(subtable+12+4*g) == index {
+					offset = imageOffset + r.u16(subtable+14+4*g)
+					break
+				}
+			}
+		case 5:
+			numGlyphs := r.u32(subtable + 20)
+			for g := 0; g < numGlyphs && !r.bad; g++ {
+				if r.u16(subtable+24+2*g) == index {
+					offset = imageOffset + r.u32(subtable+8)*g
+					break
+				}
+			}
+			metrics = subtable + 12
+		}
+		var bigMetrics []byte
+		if metrics >= 0 {
+			bigMetrics = r.bytes(metrics, 8)
+		}
+		if r.bad || offset < 0 {
+			return colorBitmap{}, false
+		}
+		return c.cbdtImage(offset, imageFormat, bigMetrics, sizes[strike])
+	}
+	return colorBitmap{}, false
+}
+
+// cbdtImage decodes the glyph image at offset in CBDT, bigMetrics holds the metrics of format 19 images.
+func (c *colorBitmaps) cbdtImage(offset, imageFormat int, bigMetrics []byte, ppem int) (colorBitmap, bool) {
+	r := tableReader{b: c.cbdt}
+
+	var bearingH, bearingV, data int
+	switch imageFormat {
+	case 17:
+		// small glyph metrics: height, width, bearingX, bearingY, advance
+		bearingH, bearingV = r.i8(offset+2), r.i8(offset+3)
+		data = offset + 5
+	case 18:
+		// big glyph metrics, horizontal bearings after height and width
+		bearingH, bearingV = r.i8(offset+2), r.i8(offset+3)
+		data = offset + 8
+	case 19:
+		if len(bigMetrics) < 8 {
+			return colorBitmap{}, false
+		}
+		bearingH, bearingV = int(int8(bigMetrics[2])), int(int8(bigMetrics[3]))
+		data = offset
+	default:
+		return colorBitmap{}, false
+	}
+
+	img, ok := decodePNG(r.bytes(data+4, r.u32(data)))
+	if r.bad || !ok {
+		return colorBitmap{}, false
+	}
+	return colorBitmap{img: img, ppem: ppem, bearingH: bearingH, bearingV: bearingV}, true
+}
+
+// decodePNG decodes an embedded PNG bitmap.
+func decodePNG(data []byte) (image.Image, bool) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil || img.Bounds().Empty() {
+		return nil, false
+	}
+	return img, true
+}
+
+// scaled returns the bitmap resized by s and its bearings in pixels at that size,
+// as premultiplied RGBA.
+func (bm colorBitmap) scaled(s float64) (img *image.RGBA, bearingH, bearingV int) {
+	b := bm.img.Bounds()
+	w := int(math.Max(1, math.Round(float64(b.Dx())*s)))
+	h := int(math.Max(1, math.Round(float64(b.Dy())*s)))
+
+	img = image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(img, img.Bounds(), bm.img, b, draw.Src, nil)
+	return img, int(math.Round(float64(bm.bearingH) * s)), int(math.Round(float64(bm.bearingV) * s))
+}
+
+// tableReader reads big endian values from a font table, reads out of bounds return 0 and set bad.
+type tableReader struct {
+	b   []byte
+	bad bool
+}
+
+// bytes returns n bytes at i.
+func (r *tableReader) bytes(i, n int) []byte {
+	if i < 0 || n < 0 || i+n > len(r.b) {
+		r.bad = true
+		return nil
+	}
+	return r.b[i : i+n]
+}
+
+func (r *tableReader) u8(i int) int {
+	if b := r.bytes(i, 1); b != nil {
+		return int(b[0])
+	}
+	return 0
+}
+
+func (r *tableReader) i8(i int) int {
+	return int(int8(r.u8(i)))
+}
+
+func (r *tableReader) u16(i int) int {
+	if b := r.bytes(i, 2); b != nil {
+		return int(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (r *tableReader) i16(i int) int {
+	return int(int16(r.u16(i)))
+}
+
+func (r *tableReader) u32(i int) int {
+	if b := r.bytes(i, 4); b != nil {
+		return int(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+// colorGlyph packs the color bitmap of r into the color atlas if the font has one for it.
+// GenerateGlyphs calls it holding the lock with the atlas texture bound.
+func (f *Font) colorGlyph(r rune) (*character, bool, error) {
+	if f.bitmaps == nil {
+		return nil, false, nil
+	}
+
+	var buf sfnt.Buffer
+	index, err := f.sfnt.GlyphIndex(&buf, r)
+	if err != nil || index == 0 {
+		return nil, false, nil
+	}
+	size := f.pixelSize()
+	bm, ok := f.bitmaps.glyph(index, size)
+	if !ok || bm.ppem <= 0 {
+		return nil, false, nil
+	}
+	advance, ok := f.face.GlyphAdvance(r)
+	if !ok {
+		return nil, false, nil
+	}
+
+	// bitmaps come in a few strike sizes, scale them to the size outlines are rasterized at
+	img, bearingH, bearingV := bm.scaled(size / float64(bm.ppem))
+
+	char := &character{
+		width:    img.Rect.Dx(),
+		height:   img.Rect.Dy(),
+		advance:  int(advance),
+		vadvance: f.verticalAdvance(r),
+		bearingH: bearingH,
+		// bitmaps measure up from the baseline to their top edge, glyphs down to their bottom edge
+		bearingV: img.Rect.Dy() - bearingV,
+	}
+	if err := f.packColor(char, img); err != nil {
+		return nil, false, err
+	}
+	return char, true, nil
+}
+
+// packColor adds the RGBA image of a glyph to the color atlas, created on first use, and places char on it.
+// GenerateGlyphs calls it holding the lock with the atlas texture bound.
+func (f *Font) packColor(char *character, img image.Image) error {
+	if f.colorAtlas == nil {
+		f.colorAtlas = newColorAtlas(f.padding)
+		f.colorAtlas.mipmaps = f.atlas.mipmaps
+		f.colorAtlas.setFilter(f.atlas.min, f.atlas.mag)
+	}
+	gl.BindTexture(gl.TEXTURE_2D, f.colorAtlas.texture)
+	defer gl.BindTexture(gl.TEXTURE_2D, f.atlas.texture)
+
+	_, oldHeight := f.colorAtlas.size()
+	ax, ay, err := f.colorAtlas.add(img)
+	if err != nil {
+		return err
+	}
+	f.colorAtlas.updateMipmaps()
+
+	char.colored = true
+	f.place(char, f.colorAtlas, ax, ay, oldHeight)
+	return nil
+}
+
+// bake colors glyph coverage with c, as premultiplied RGBA.
+func bake(coverage *image.Alpha, c color) *image.RGBA {
+	img := image.NewRGBA(coverage.Rect)
+	for i, a := range coverage.Pix {
+		alpha := c.a * float32(a) / 255
+		img.Pix[4*i] = uint8(c.r*alpha*255 + 0.5)
+		img.Pix[4*i+1] = uint8(c.g*alpha*255 + 0.5)
+		img.Pix[4*i+2] = uint8(c.b*alpha*255 + 0.5)
+		img.Pix[4*i+3] = uint8(alpha*255 + 0.5)
+	}
+	return img
+}
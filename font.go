@@ -3,9 +3,16 @@ package glfont
 import (
 	"bytes"
 	"fmt"
+	"io/fs"
+	"math"
 	"os"
+	"sort"
+	"strings"
+	"unicode"
 
 	"github.com/go-gl/gl/all-core/gl"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
 )
 
 // Direction represents the direction in which strings should be rendered.
@@ -18,6 +25,75 @@ const (
 	TopToBottom                  // E.g.: Chinese
 )
 
+// Metrics holds the vertical metrics of a font in pixels at its loaded scale.
+type Metrics struct {
+	Ascent     float32 // Distance from the top of a line to the baseline.
+	Descent    float32 // Distance from the baseline to the bottom of a line.
+	LineGap    float32 // Extra space between the bottom of a line and the top of the next.
+	LineHeight float32 // Distance between two baselines, Ascent + Descent + LineGap.
+
+	// Underline placement from the font's post table, or derived from the font size if it has none.
+	UnderlineOffset    float32 // Distance from the baseline down to the top of the underline.
+	UnderlineThickness float32 // Thickness of underlines and strikethroughs.
+}
+
+// GlyphMetrics holds the size and placement of a glyph in pixels at the loaded scale.
+type GlyphMetrics struct {
+	Width    float32 // Width of the glyph image.
+	Height   float32 // Height of the glyph image.
+	Advance  float32 // Distance the pen moves right after the glyph.
+	VAdvance float32 // Distance the pen moves down after the glyph in TopToBottom text.
+	BearingH float32 // Distance from the pen to the left edge of the glyph.
+	BearingV float32 // Distance from the baseline down to the bottom edge of the glyph.
+}
+
+// Align represents the horizontal alignment of text relative to the x position.
+type Align uint8
+
+// Known alignments.
+const (
+	AlignLeft    Align = iota // Text starts at x
+	AlignCenter               // Text is centered on x
+	AlignRight                // Text ends at x
+	AlignJustify              // Wrapped lines fill the width by widening their spaces, other text starts at x
+)
+
+// VAlign represents the vertical alignment of text in a box.
+type VAlign uint8
+
+// Known vertical alignments.
+const (
+	VAlignTop    VAlign = iota // Text starts at the top of the box
+	VAlignMiddle               // Text is centered in the box
+	VAlignBottom               // Text ends at the bottom of the box
+)
+
+// GlyphPlacement is the position of a rune laid out by LayoutRunes.
+type GlyphPlacement struct {
+	Rune    rune
+	X, Y    float32 // Pen position the glyph is drawn from on the baseline, the top of its cell for TopToBottom text.
+	Advance float32 // Distance the pen steps over the rune, 0 for combining marks, newlines and runes without glyph.
+}
+
+// TextRun is a piece of text drawn in its own color by PrintfRuns.
+type TextRun struct {
+	Text  string
+	Color [4]float32 // Red, green, blue and alpha.
+}
+
+// underlay is a copy of the text drawn below it in its own color, once for every offset.
+type underlay struct {
+	color   color
+	offsets [][2]float32 // Screen space offsets in pixels.
+}
+
+// A glyph is drawn as a quad of two triangles, each vertex holds x, y, u and v.
+// DrawArrays counts vertices, the vbo holds floatsPerGlyph floats per glyph.
+const (
+	floatsPerVertex = 4
+	floatsPerGlyph  = 6 * floatsPerVertex
+)
+
 type color struct {
 	r float32
 	g float32
@@ -25,12 +101,25 @@ type color struct {
 	a float32
 }
 
+// format formats fs with argv like fmt.Sprintf. Without arguments fs is returned as is,
+// so a literal % in plain text is not taken for a verb.
+func format(fs string, argv []interface{}) string {
+	if len(argv) == 0 {
+		return fs
+	}
+	return fmt.Sprintf(fs, argv...)
+}
+
+func newColor(c [4]float32) color {
+	return color{c[0], c[1], c[2], c[3]}
+}
+
 // Use default preapration for exported functions like `LoadFont` and `LoadFontFromBytes`
-func configureDefaults(windowWidth int, windowHeight int) uint32 {
-	// Configure the default font vertex and fragment shaders
-	program, err := newProgram(vertexFontShader, fragmentFontShader)
+func configureDefaults(windowWidth int, windowHeight int) (uint32, error) {
+	// Get the program of the default font vertex and fragment shaders, it is compiled once and shared
+	program, err := acquireDefaultProgram()
 	if err != nil {
-		panic(err)
+		return 0, err
 	}
 
 	// Activate corresponding render state
@@ -40,15 +129,23 @@ func configureDefaults(windowWidth int, windowHeight int) uint32 {
 	resUniform := gl.GetUniformLocation(program, gl.Str("resolution\x00"))
 	gl.Uniform2f(resUniform, float32(windowWidth), float32(windowHeight))
 
-	return program
+	return program, nil
 }
 
 // LoadFontBytes loads the specified font bytes at the given scale.
 func LoadFontBytes(buf []byte, scale int32, windowWidth int, windowHeight int) (*Font, error) {
-	program := configureDefaults(windowWidth, windowHeight)
+	program, err := configureDefaults(windowWidth, windowHeight)
+	if err != nil {
+		return nil, err
+	}
 
 	fd := bytes.NewReader(buf)
-	return LoadTrueTypeFont(program, fd, scale, 32, 127, LeftToRight)
+	f, err := loadTrueTypeFont(program, fd, scale, 32, 127, LeftToRight)
+	if err != nil {
+		releaseProgram(program)
+		return nil, err
+	}
+	return f, nil
 }
 
 // LoadFont loads the specified font at the given scale.
@@ -59,9 +156,206 @@ func LoadFont(file string, scale int32, windowWidth int, windowHeight int) (*Fon
 	}
 	defer fd.Close()
 
-	program := configureDefaults(windowWidth, windowHeight)
+	program, err := configureDefaults(windowWidth, windowHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := loadTrueTypeFont(program, fd, scale, 32, 127, LeftToRight)
+	if err != nil {
+		releaseProgram(program)
+		return nil, err
+	}
+	return f, nil
+}
+
+// LoadFontFS loads the named font from the file system at the given scale,
+// e.g. a font embedded with go:embed.
+func LoadFontFS(fsys fs.FS, name string, scale int32, windowWidth int, windowHeight int) (*Font, error) {
+	fd, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	program, err := configureDefaults(windowWidth, windowHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := loadTrueTypeFont(program, fd, scale, 32, 127, LeftToRight)
+	if err != nil {
+		releaseProgram(program)
+		return nil, err
+	}
+	return f, nil
+}
+
+// AddFallback adds a font to draw runes from that this font has no glyph for.
+// Fallbacks are tried in the order they were added, their glyphs are sized to match this font.
+// The fallback must not be released while this font uses it.
+func (f *Font) AddFallback(other *Font) {
+	f.fallbacks = append(f.fallbacks, other)
+}
+
+// advances returns the horizontal and vertical advance of r in 1/64 glyph pixels and the font drawing it,
+// like glyphFrom but read from the face for glyphs that are not loaded yet, without rasterizing them.
+func (f *Font) advances(r rune) (advance, vadvance int, src *Font, ok bool) {
+	if ch, ok := f.lookup(r); ok {
+		return ch.advance, ch.vadvance, f, true
+	}
+
+	if len(f.fallbacks) > 0 && !f.HasGlyph(r) {
+		for _, fallback := range f.fallbacks {
+			if fallback.HasGlyph(r) {
+				advance, vadvance, ok := fallback.faceAdvances(r)
+				return advance, vadvance, fallback, ok
+			}
+		}
+	}
+
+	advance, vadvance, ok = f.faceAdvances(r)
+	return advance, vadvance, f, ok
+}
+
+// glyphFrom returns the glyph of r and the font it comes from,
+// the first fallback with a glyph for r if the font has none.
+func (f *Font) glyphFrom(r rune) (character, *Font, bool) {
+	if ch, ok := f.lookup(r); ok {
+		return ch, f, true
+	}
+
+	if len(f.fallbacks) > 0 && !f.HasGlyph(r) {
+		for _, fallback := range f.fallbacks {
+			if fallback.HasGlyph(r) {
+				ch, ok := fallback.glyph(r)
+				return ch, fallback, ok
+			}
+		}
+	}
+
+	ch, ok := f.glyph(r)
+	return ch, f, ok
+}
+
+// glyphScale returns the factor glyph pixels of src are scaled by to logical pixels of this font,
+// src is the font itself or a fallback.
+func (f *Font) glyphScale(src *Font) float32 {
+	return float32(f.scale) / (float32(src.scale) * src.pixelRatio())
+}
+
+// Glyph returns the metrics of the glyph for r, false if the font has none.
+// Like Width it reads the font without rasterizing glyphs or making OpenGL calls.
+func (f *Font) Glyph(r rune) (GlyphMetrics, bool) {
+	if !f.HasGlyph(r) {
+		return GlyphMetrics{}, false
+	}
+
+	f.mu.Lock()
+	bounds, advance, ok := f.face.GlyphBounds(r)
+	f.mu.Unlock()
+	if !ok {
+		return GlyphMetrics{}, false
+	}
+
+	// same whole pixel bounds as GenerateGlyphs, in logical pixels
+	ratio := f.pixelRatio()
+	minX, minY := bounds.Min.X.Floor(), bounds.Min.Y.Floor()
+	maxX, maxY := bounds.Max.X.Ceil(), bounds.Max.Y.Ceil()
+	return GlyphMetrics{
+		Width:    float32(maxX-minX) / ratio,
+		Height:   float32(maxY-minY) / ratio,
+		Advance:  float32(advance>>6) / ratio,
+		VAdvance: float32(f.verticalAdvance(r)>>6) / ratio,
+		BearingH: float32(minX) / ratio,
+		BearingV: float32(maxY) / ratio,
+	}, true
+}
+
+// HasGlyph reports whether the font has a glyph for r, without rasterizing it.
+func (f *Font) HasGlyph(r rune) bool {
+	// Reload swaps the parsed font under the lock
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.hasGlyph(r)
+}
+
+// hasGlyph is HasGlyph for callers holding the lock.
+func (f *Font) hasGlyph(r rune) bool {
+	if f.ttf != nil {
+		return f.ttf.Index(r) != 0
+	}
+
+	var buf sfnt.Buffer
+	index, err := f.sfnt.GlyphIndex(&buf, r)
+	return err == nil && index != 0
+}
+
+// Preload generates the glyphs from low to high up front, e.g. during a loading screen,
+// so drawing them later does not stall on rasterizing. Glyphs already loaded are skipped.
+func (f *Font) Preload(low, high rune) error {
+	return f.GenerateGlyphs(low, high)
+}
+
+// PreloadString generates the glyphs of all runes in s up front, like Preload.
+func (f *Font) PreloadString(s string) error {
+	for _, r := range s {
+		// layout characters have no glyph
+		if r == '\n' || r == '\r' || r == '\t' {
+			continue
+		}
+		if _, ok := f.lookup(r); ok {
+			continue
+		}
+		err := f.GenerateGlyphs(r, r)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetBackground draws a box in the given color behind each drawn line of text.
+// The box spans the ascent and descent of the line. TopToBottom text gets no background.
+func (f *Font) SetBackground(color [4]float32, enabled bool) {
+	if !enabled {
+		f.background = nil
+		return
+	}
+	c := newColor(color)
+	f.background = &c
+}
+
+// SetBakedColor rasterizes glyphs in the given color and stores them in color, instead of coloring
+// them while drawing. SetColor then only fades baked text with its alpha, so strings drawn with
+// different baked fonts need no color change in between. Baked glyphs are drawn without shadows,
+// outlines and fake bold. The glyphs loaded so far are generated again.
+func (f *Font) SetBakedColor(color [4]float32, enabled bool) error {
+	if !enabled {
+		if f.baked == nil {
+			return nil
+		}
+		f.baked = nil
+		return f.regenerate(f.clearGlyphs())
+	}
+
+	c := newColor(color)
+	if f.baked != nil && *f.baked == c {
+		return nil
+	}
+	f.baked = &c
+	return f.regenerate(f.clearGlyphs())
+}
+
+// SetClipRect clips drawn text to the rectangle at x, y with size w, h in pixels, in the coordinates passed to Printf.
+// Glyphs crossing its edges are cut off, glyphs outside are not drawn.
+func (f *Font) SetClipRect(x, y, w, h float32) {
+	f.clip = &[4]float32{x, y, w, h}
+}
 
-	return LoadTrueTypeFont(program, fd, scale, 32, 127, LeftToRight)
+// ClearClipRect stops clipping text.
+func (f *Font) ClearClipRect() {
+	f.clip = nil
 }
 
 // SetColor allows you to set the text color to be used when you draw the text
@@ -72,137 +366,1683 @@ func (f *Font) SetColor(red float32, green float32, blue float32, alpha float32)
 	f.color.a = alpha
 }
 
-// UpdateResolution used to recalibrate fonts for new window size
-func (f *Font) UpdateResolution(windowWidth int, windowHeight int) {
-	gl.UseProgram(f.program)
-	resUniform := gl.GetUniformLocation(f.program, gl.Str("resolution\x00"))
-	gl.Uniform2f(resUniform, float32(windowWidth), float32(windowHeight))
-	gl.UseProgram(0)
+// SetAlpha sets the alpha of the text color, keeping its red, green and blue.
+func (f *Font) SetAlpha(alpha float32) {
+	f.color.a = alpha
+}
+
+// Metrics returns the vertical metrics of the font in pixels.
+// Multiply the values by the scale passed to Printf to get the drawn size.
+func (f *Font) Metrics() Metrics {
+	ascent := float32(f.metrics.Ascent) / 64
+	descent := float32(f.metrics.Descent) / 64
+	height := f.lineHeight()
+	offset, thickness := f.underlineMetrics()
+	return Metrics{
+		Ascent:             ascent,
+		Descent:            descent,
+		LineGap:            height - ascent - descent,
+		LineHeight:         height,
+		UnderlineOffset:    offset,
+		UnderlineThickness: thickness,
+	}
 }
 
-// Printf draws a string to the screen, takes a list of arguments like printf
-func (f *Font) Printf(x, y float32, scale float32, fs string, argv ...interface{}) error {
+// Direction returns the direction in which strings are rendered.
+func (f *Font) Direction() Direction {
+	return f.direction
+}
 
-	indices := []rune(fmt.Sprintf(fs, argv...))
+// SetFilter sets the texture filters of the glyph atlas, e.g. gl.NEAREST for both to keep
+// pixel fonts crisp when drawn at a multiple of their size. Both are gl.LINEAR by default.
+func (f *Font) SetFilter(min, mag int32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-	if len(indices) == 0 {
-		return nil
+	// keep the texture the application has bound
+	var saved textureState
+	saved.save()
+	defer saved.restore()
+
+	gl.BindTexture(gl.TEXTURE_2D, f.atlas.texture)
+	f.atlas.setFilter(min, mag)
+	if f.colorAtlas != nil {
+		gl.BindTexture(gl.TEXTURE_2D, f.colorAtlas.texture)
+		f.colorAtlas.setFilter(min, mag)
 	}
+}
 
-	// setup blending mode
-	gl.Enable(gl.BLEND)
-	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+// SetGamma sets the gamma applied to the glyph coverage, 1.0 by default.
+// Values above 1.0 make antialiased edges heavier, values below 1.0 make them thinner.
+func (f *Font) SetGamma(gamma float32) {
+	f.gamma = gamma
+}
 
-	// Activate corresponding render state
-	gl.UseProgram(f.program)
-	// set text color
-	gl.Uniform4f(gl.GetUniformLocation(f.program, gl.Str("textColor\x00")), f.color.r, f.color.g, f.color.b, f.color.a)
-	// set screen resolution
-	// resUniform := gl.GetUniformLocation(f.program, gl.Str("resolution\x00"))
-	// gl.Uniform2f(resUniform, float32(2560), float32(1440))
+// SetDirection sets the direction in which strings are rendered.
+// RightToLeft lays glyphs out in visual order, contextual shaping is not applied.
+func (f *Font) SetDirection(dir Direction) {
+	f.direction = dir
+}
 
-	gl.ActiveTexture(gl.TEXTURE0)
-	gl.BindVertexArray(f.vao)
+// SetSRGB tells the font it draws to an sRGB framebuffer with GL_FRAMEBUFFER_SRGB enabled, which blends in linear light.
+// The shader then converts the text colors from sRGB to linear and corrects the glyph coverage,
+// so text keeps the color and weight it has on other framebuffers. It is off by default.
+func (f *Font) SetSRGB(enabled bool) {
+	f.srgb = enabled
+}
 
-	// Iterate through all characters in string
-	for i := range indices {
+// SetLineSpacing sets the distance between lines as a multiple of the line height, 1.0 by default.
+func (f *Font) SetLineSpacing(factor float32) {
+	f.lineSpacing = factor
+}
 
-		// get rune
-		runeIndex := indices[i]
+// SetLetterSpacing adds px pixels, times the drawing scale, between every two glyphs.
+// Negative values tighten the text, but never move a glyph back past the previous one.
+func (f *Font) SetLetterSpacing(px float32) {
+	f.letterSpacing = px
+}
 
-		// find rune in fontChar list
-		ch, ok := f.fontChar[runeIndex]
+// SetFixedAdvance lays horizontal text out on a grid of cells px pixels wide, times the drawing scale,
+// like a monospaced font. Each glyph is centered in its cell and the pen steps exactly one cell per rune,
+// without kerning or letter spacing, so Width is the number of runes times px times scale,
+// also for italic text.
+// Zero restores proportional spacing.
+func (f *Font) SetFixedAdvance(px float32) {
+	if px < 0 {
+		px = 0
+	}
+	f.fixedAdvance = px
+}
 
-		// load missing runes in batches of 32
-		if !ok {
-			low := runeIndex - (runeIndex % 32)
-			f.GenerateGlyphs(low, low+31)
-			ch, ok = f.fontChar[runeIndex]
-		}
+// SetAdvanceOverride makes the pen step advancePx pixels at scale 1 over r instead of the font's advance,
+// for fixing the spacing of a glyph or aligning icon glyphs to a grid. Drawing and measuring both use it,
+// it takes precedence over SetFixedAdvance and applies to horizontal text.
+func (f *Font) SetAdvanceOverride(r rune, advancePx float32) {
+	if f.advanceOverrides == nil {
+		f.advanceOverrides = make(map[rune]float32)
+	}
+	f.advanceOverrides[r] = advancePx
+}
 
-		// skip runes that are not in font chacter range
-		if !ok {
-			fmt.Printf("%c %d\n", runeIndex, runeIndex)
-			continue
-		}
+// ClearAdvanceOverrides removes the advances set with SetAdvanceOverride, runes step by the font's advances again.
+func (f *Font) ClearAdvanceOverrides() {
+	f.advanceOverrides = nil
+}
 
-		// calculate position and size for current rune
-		xpos := x + float32(ch.bearingH)*scale
-		ypos := y - float32(ch.height-ch.bearingV)*scale
-		w := float32(ch.width) * scale
-		h := float32(ch.height) * scale
-		vertices := []float32{
-			xpos + w, ypos, 1.0, 0.0,
-			xpos, ypos, 0.0, 0.0,
-			xpos, ypos + h, 0.0, 1.0,
+// SetKerning turns kerning between glyph pairs on or off. Kerning is on by default.
+func (f *Font) SetKerning(enabled bool) {
+	f.kerning = enabled
+}
 
-			xpos, ypos + h, 0.0, 1.0,
-			xpos + w, ypos + h, 1.0, 1.0,
-			xpos + w, ypos, 1.0, 0.0,
-		}
+// SetTabWidth sets the distance between tab stops as a number of spaces, 4 by default.
+// A tab moves the pen to the next tab stop measured from the start of the line.
+func (f *Font) SetTabWidth(spaces int) {
+	f.tabWidth = spaces
+}
 
-		// Render glyph texture over quad
-		gl.BindTexture(gl.TEXTURE_2D, ch.textureID)
-		// Update content of VBO memory
-		gl.BindBuffer(gl.ARRAY_BUFFER, f.vbo)
+// SetGlyphBatchSize sets how many glyphs are rasterized together when a rune without a loaded glyph
+// is drawn, 32 by default. Batches are aligned, a rune loads its neighbours in the code point range.
+// Use 1 to rasterize strictly the glyphs drawn. Measuring with Width never rasterizes glyphs.
+func (f *Font) SetGlyphBatchSize(n int) {
+	if n < 1 {
+		n = 1
+	}
+	// a batch never needs to span more than all code points
+	if n > unicode.MaxRune+1 {
+		n = unicode.MaxRune + 1
+	}
+	f.batchSize = n
+}
 
-		// BufferSubData(target Enum, offset int, data []byte)
-		gl.BufferSubData(gl.ARRAY_BUFFER, 0, len(vertices)*4, gl.Ptr(vertices)) // Be sure to use glBufferSubData and not glBufferData
-		// Render quad
-		gl.DrawArrays(gl.TRIANGLES, 0, 16)
+// SetMaxGlyphs caps the number of glyphs kept in the atlas, for text using many unique glyphs like CJK.
+// Drawing and measuring text mark its glyphs as used. After drawing text, once more than n glyphs are loaded,
+// the least recently used are dropped down to three quarters of n and the rest are packed into a new atlas,
+// which starts at its initial size again. Dropped glyphs are loaded again when needed.
+// Vertices from BuildVertices are invalidated by that. A limit of 0, the default, keeps all glyphs.
+func (f *Font) SetMaxGlyphs(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-		gl.BindBuffer(gl.ARRAY_BUFFER, 0)
-		// Now advance cursors for next glyph (note that advance is number of 1/64 pixels)
-		x += float32((ch.advance >> 6)) * scale // Bitshift by 6 to get value in pixels (2^6 = 64 (divide amount of 1/64th pixels by 64 to get amount of pixels))
+	if n < 0 {
+		n = 0
+	}
+	f.maxGlyphs = n
 
+	f.usedMu.Lock()
+	defer f.usedMu.Unlock()
+	if f.used == nil {
+		f.used = make(map[rune]uint64)
 	}
+}
 
-	// clear opengl textures and programs
-	gl.BindVertexArray(0)
-	gl.BindTexture(gl.TEXTURE_2D, 0)
-	gl.UseProgram(0)
-	gl.Disable(gl.BLEND)
+// SetTabStops places tab stops at the given offsets in pixels, times the drawing scale,
+// from the start of the line, for aligning columns of tables. A tab moves the pen to the first stop
+// past it, tabs after the last stop use the tab width. Width measures tabs with the same stops.
+// Nil goes back to tab stops every tab width.
+func (f *Font) SetTabStops(stops []float32) {
+	f.tabStops = append([]float32(nil), stops...)
+	sort.Slice(f.tabStops, func(i, j int) bool { return f.tabStops[i] < f.tabStops[j] })
+}
 
-	return nil
+// SetUnderline turns drawing a line below the text on or off.
+// The line spans each drawn line of text in the text color, TopToBottom text is not underlined.
+func (f *Font) SetUnderline(enabled bool) {
+	f.underline = enabled
 }
 
-// Width returns the width of a piece of text in pixels
-func (f *Font) Width(scale float32, fs string, argv ...interface{}) float32 {
+// SetStrikethrough turns drawing a line through the middle of the text on or off.
+// Like the underline it spans each drawn line of text in the text color.
+func (f *Font) SetStrikethrough(enabled bool) {
+	f.strikethrough = enabled
+}
 
-	var width float32
+// SetFakeBold thickens glyphs by strength pixels, times the drawing scale, to emulate a bold font.
+// Each glyph is drawn several times shifted to the right and its advance grows by the strength.
+// A real bold font looks better, 0 turns fake bold off.
+func (f *Font) SetFakeBold(strength float32) {
+	if strength < 0 {
+		strength = 0
+	}
+	f.bold = strength
+}
 
-	indices := []rune(fmt.Sprintf(fs, argv...))
+// SetFakeItalic slants glyphs to emulate an italic font. Each glyph is sheared horizontally
+// by shear pixels per pixel of height above the baseline, 0.2 is a typical slant and 0 turns it off.
+func (f *Font) SetFakeItalic(shear float32) {
+	f.italic = shear
+}
 
-	if len(indices) == 0 {
-		return 0
+// SetShadow draws the text a second time, offset by (offsetX, offsetY) pixels in the given color, below the text.
+// The shadow does not change the measured size of the text.
+func (f *Font) SetShadow(offsetX, offsetY float32, color [4]float32, enabled bool) {
+	if !enabled {
+		f.shadow = nil
+		return
+	}
+	f.shadow = &underlay{
+		color:   newColor(color),
+		offsets: [][2]float32{{offsetX, offsetY}},
 	}
+}
 
-	// Iterate through all characters in string
-	for i := range indices {
+// SetMissingGlyphFunc sets a function called with every rune that is skipped
+// because the font has no glyph for it, nil by default. Runes are reported each time they are drawn or measured.
+func (f *Font) SetMissingGlyphFunc(fn func(r rune)) {
+	f.missingGlyph = fn
+}
 
-		// get rune
-		runeIndex := indices[i]
+// reportMissing passes a skipped rune to the missing glyph function and the logger.
+func (f *Font) reportMissing(r rune) {
+	logf("glfont: no glyph for %q (%U)", r, r)
+	if f.missingGlyph != nil {
+		f.missingGlyph(r)
+	}
+}
 
-		// find rune in fontChar list
-		ch, ok := f.fontChar[runeIndex]
+// SetMipmaps turns mipmaps of the glyph atlas on or off, off by default. Mipmaps reduce shimmering
+// of text drawn much smaller than the scale it was loaded at. While they are on the minifying
+// filter is gl.LINEAR_MIPMAP_LINEAR.
+func (f *Font) SetMipmaps(enabled bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-		// load missing runes in batches of 32
-		if !ok {
-			low := runeIndex & rune(32-1)
-			f.GenerateGlyphs(low, low+31)
-			ch, ok = f.fontChar[runeIndex]
-		}
+	// keep the texture the application has bound
+	var saved textureState
+	saved.save()
+	defer saved.restore()
 
-		// skip runes that are not in font chacter range
-		if !ok {
-			fmt.Printf("%c %d\n", runeIndex, runeIndex)
-			continue
-		}
+	gl.BindTexture(gl.TEXTURE_2D, f.atlas.texture)
+	f.atlas.setMipmaps(enabled)
+	if f.colorAtlas != nil {
+		gl.BindTexture(gl.TEXTURE_2D, f.colorAtlas.texture)
+		f.colorAtlas.setMipmaps(enabled)
+	}
+}
 
-		// Now advance cursors for next glyph (note that advance is number of 1/64 pixels)
-		width += float32((ch.advance >> 6)) * scale // Bitshift by 6 to get value in pixels (2^6 = 64 (divide amount of 1/64th pixels by 64 to get amount of pixels))
+// SetOutline draws a border of width pixels in the given color around the glyphs.
+// The text is drawn eight times around its position below the fill, a width of 0 turns the outline off.
+func (f *Font) SetOutline(width float32, color [4]float32) {
+	if width <= 0 {
+		f.outline = nil
+		return
+	}
 
+	outline := &underlay{color: newColor(color)}
+	for i := 0; i < 8; i++ {
+		angle := float64(i) * math.Pi / 4
+		outline.offsets = append(outline.offsets, [2]float32{
+			width * float32(math.Cos(angle)),
+			width * float32(math.Sin(angle)),
+		})
 	}
+	f.outline = outline
+}
 
-	return width
+// SetScale changes the size glyphs are rasterized at without loading the font again.
+// The glyph atlas is cleared and glyphs are generated again at the new size as they are drawn.
+// Metrics and the line height follow the new scale.
+func (f *Font) SetScale(scale int32) error {
+	if scale == f.scale {
+		return nil
+	}
+	if scale <= 0 {
+		return fmt.Errorf("invalid scale %d", scale)
+	}
+	_, err := f.setRasterizer(scale, f.dpi, f.hinting)
+	return err
+}
+
+// SetDPI rasterizes glyphs for a display with the given dots per inch, 72 by default.
+// Text keeps its size in logical pixels, on a HiDPI display pass e.g. 144 for a content scale of 2
+// to get glyphs with twice the resolution. The glyph atlas is cleared like with SetScale.
+func (f *Font) SetDPI(dpi float64) error {
+	if dpi == f.dpi {
+		return nil
+	}
+	if dpi <= 0 {
+		return fmt.Errorf("invalid dpi %v", dpi)
+	}
+	_, err := f.setRasterizer(f.scale, dpi, f.hinting)
+	return err
+}
+
+// SetHinting changes how glyph outlines are fitted to the pixel grid, font.HintingFull by default.
+// font.HintingNone keeps the shapes the designer drew and scales smoothly, which suits animated text.
+// The glyphs loaded so far are generated again with the new hinting.
+func (f *Font) SetHinting(hinting font.Hinting) error {
+	if hinting == f.hinting {
+		return nil
+	}
+	if hinting != font.HintingNone && hinting != font.HintingVertical && hinting != font.HintingFull {
+		return fmt.Errorf("invalid hinting %v", hinting)
+	}
+	runes, err := f.setRasterizer(f.scale, f.dpi, hinting)
+	if err != nil {
+		return err
+	}
+	return f.regenerate(runes)
+}
+
+// SetSDF switches between coverage glyphs and signed distance field glyphs.
+// Distance field glyphs stay sharp when drawn much larger or smaller than the loaded scale.
+// The glyphs loaded so far are generated again in the new format.
+func (f *Font) SetSDF(enabled bool) error {
+	if enabled == f.sdf {
+		return nil
+	}
+
+	f.sdf = enabled
+	return f.regenerate(f.clearGlyphs())
+}
+
+// SetAntialias turns antialiasing of glyph edges on or off, on by default. Without it glyphs are
+// rasterized with hard edges and the atlas filters are set to gl.NEAREST, for pixel and terminal fonts;
+// turning it back on sets them to gl.LINEAR. The glyphs loaded so far are generated again.
+func (f *Font) SetAntialias(enabled bool) error {
+	if enabled != f.aliased {
+		return nil
+	}
+
+	f.aliased = !enabled
+	runes := f.clearGlyphs()
+	filter := int32(gl.LINEAR)
+	if !enabled {
+		filter = gl.NEAREST
+	}
+	f.SetFilter(filter, filter)
+	return f.regenerate(runes)
+}
+
+// SetAtlasPadding keeps px transparent pixels around each glyph in the glyph atlas, 1 by default.
+// Padding stops linear filtering and mipmaps from sampling the edges of neighbouring glyphs,
+// raise it when text is drawn much smaller than it was loaded. The glyphs loaded so far are generated again.
+func (f *Font) SetAtlasPadding(px int) error {
+	if px == f.padding {
+		return nil
+	}
+	if px < 0 {
+		return fmt.Errorf("invalid atlas padding %d", px)
+	}
+
+	f.padding = px
+	return f.regenerate(f.clearGlyphs())
+}
+
+// SetInkAlign turns moving the first glyph of each line right by its negative left side bearing on or off, off by default.
+// Glyphs like an italic f reach left of the pen, with ink alignment their ink starts at x instead,
+// so text aligned to an edge is not clipped. Width and the other measurements include the shift.
+// It applies to LeftToRight text, Glyph reports the bearings for laying out other text by hand.
+func (f *Font) SetInkAlign(enabled bool) {
+	f.inkAlign = enabled
+}
+
+// SetPixelSnap turns rounding glyph positions to whole display pixels on or off, off by default.
+// Snapped text is sharper, unsnapped text moves smoothly when it is animated or scrolled.
+func (f *Font) SetPixelSnap(enabled bool) {
+	f.pixelSnap = enabled
+}
+
+// SetProgram replaces the shader program the font draws with. The program stays the caller's like one
+// passed to LoadTrueTypeFont, it can be set on many fonts and is not deleted when they are released.
+// Call UpdateResolution afterwards to set the window size on the new program.
+//
+// The vertex shader gets each vertex from the attributes
+//
+//	in vec2 vert;         // position in pixels, y pointing down
+//	in vec2 vertTexCoord; // position in the glyph atlas
+//
+// and maps it to clip space with uniform vec2 resolution, the window size in pixels.
+// The fragment shader samples the glyph coverage from the red channel of uniform sampler2D tex
+// and colors it with uniform vec4 textColor, blending expects premultiplied alpha.
+// The other uniforms of the default shaders are optional: mat3 transform, applied to vert
+// for PrintfRotated, shadows and outlines, float gamma, bool sdf, mat4 projection and bool useProjection,
+// and bool clip and vec4 clipRect, tested against the transformed vert passed as fragPosition,
+// bool colored, set while color glyphs are drawn from a premultiplied RGBA texture, and bool srgb, set by SetSRGB.
+func (f *Font) SetProgram(program uint32) {
+	if program == f.program {
+		return
+	}
+	retainProgram(program)
+	releaseProgram(f.program)
+	f.program = program
+
+	// attribute locations belong to the program, fonts sharing the vao keep theirs
+	if f.users > 1 {
+		f.releaseBuffers()
+		f.newBuffers()
+		return
+	}
+	gl.DeleteVertexArrays(1, &f.vao)
+	f.newVertexArray()
+}
+
+// SetProjection maps text to clip space with a column major 4x4 matrix instead of the window resolution,
+// e.g. an orthographic projection of a framebuffer or a zoomed canvas.
+// Glyph positions are in pixels with y pointing down, as passed to Printf.
+func (f *Font) SetProjection(mat [16]float32) {
+	f.projection = &mat
+}
+
+// ClearProjection goes back to mapping text with the window resolution.
+func (f *Font) ClearProjection() {
+	f.projection = nil
+}
+
+// SetTextureUnit makes drawing bind the glyph atlas to texture unit unit, 0 for gl.TEXTURE0 by default,
+// for renderers that reserve unit 0. The tex sampler of the program is pointed at the same unit.
+func (f *Font) SetTextureUnit(unit uint32) {
+	f.textureUnit = unit
+}
+
+// SetAutoResolution makes drawing map text with the size of the current viewport, off by default.
+// Apps whose viewport follows the window no longer need to call UpdateResolution on every resize,
+// text is then positioned in framebuffer pixels. A projection set with SetProjection takes precedence.
+func (f *Font) SetAutoResolution(enabled bool) {
+	f.autoResolution = enabled
+}
+
+// UpdateResolution used to recalibrate fonts for new window size.
+// Fonts from LoadFont and LoadFontBytes share one program, updating one of them updates all.
+// It returns an error if the font's program is not a linked program or has no active resolution uniform,
+// as with custom shaders that map text differently, instead of drawing text that is not positioned.
+func (f *Font) UpdateResolution(windowWidth int, windowHeight int) error {
+	if !gl.IsProgram(f.program) {
+		return fmt.Errorf("font program %d is not a program", f.program)
+	}
+	resUniform := gl.GetUniformLocation(f.program, gl.Str("resolution\x00"))
+	if resUniform == -1 {
+		return fmt.Errorf("font program %d has no active vec2 resolution uniform", f.program)
+	}
+
+	gl.UseProgram(f.program)
+	gl.Uniform2f(resUniform, float32(windowWidth), float32(windowHeight))
+	gl.UseProgram(0)
+	return nil
+}
+
+// Printf draws a string to the screen, takes a list of arguments like printf.
+// A newline moves the pen back to x and down by one line height times the line spacing.
+// For RightToLeft fonts x is the right edge of the text,
+// for TopToBottom fonts y is the top of the first column and newlines start a column to the left.
+// Combining marks and other glyphs without advance are drawn over the previous glyph.
+// It returns the pen position after the last glyph, where text drawn next continues the string.
+// Without arguments fs is drawn as is, "50% done" needs no escaping.
+// Blending, the blend function, the program, the active texture unit and the texture, vertex array
+// and buffer bindings are restored afterwards, drawing text leaves the application's state as it was.
+func (f *Font) Printf(x, y float32, scale float32, fs string, argv ...interface{}) (float32, float32, error) {
+	return f.PrintRunes(x, y, scale, f.decode(format(fs, argv)))
+}
+
+// Print draws a string like Printf without formatting it, a % in s is drawn as is.
+// The runes and quads of the string are collected in buffers the font reuses, so once they have grown
+// to the longest string drawing text does not allocate them, e.g. for thousands of labels a frame.
+func (f *Font) Print(x, y, scale float32, s string) (float32, float32, error) {
+	return f.PrintRunes(x, y, scale, f.decode(s))
+}
+
+// PrintRunes draws runes like Print, for callers that already hold the text as runes.
+func (f *Font) PrintRunes(x, y, scale float32, indices []rune) (float32, float32, error) {
+	p := f.print(f.resetPen(x, y), scale, indices)
+	return p.x, p.y, nil
+}
+
+// decode converts s to runes in the font's reusable buffer, they are valid until the next call.
+func (f *Font) decode(s string) []rune {
+	f.runes = f.runes[:0]
+	for _, r := range s {
+		f.runes = append(f.runes, r)
+	}
+	return f.runes
+}
+
+// resetPen returns the font's reusable pen starting at x, y, keeping the maps and slices it allocated.
+func (f *Font) resetPen(x, y float32) *pen {
+	p := &f.pen
+	*p = pen{
+		x: x, y: y, lineX: x, lineY: y,
+		fallback:   p.fallback,
+		colored:    p.colored,
+		background: p.background[:0],
+	}
+	return p
+}
+
+// PrintfMaxRunes draws a string like Printf, but at most its first max runes,
+// for fixed columns of terminal-like text. It reports whether runes were cut off.
+func (f *Font) PrintfMaxRunes(x, y, scale float32, max int, fs string, argv ...interface{}) (bool, error) {
+	indices := []rune(format(fs, argv))
+	truncated := false
+	if max >= 0 && len(indices) > max {
+		indices = indices[:max]
+		truncated = true
+	}
+
+	_, _, err := f.PrintRunes(x, y, scale, indices)
+	return truncated, err
+}
+
+// PrintfCollect draws a string like Printf and returns the runes that were skipped
+// because neither the font nor its fallbacks have a glyph for them, in the order they appear.
+func (f *Font) PrintfCollect(x, y, scale float32, fs string, argv ...interface{}) (dropped []rune, err error) {
+	p := f.print(f.resetPen(x, y), scale, f.decode(format(fs, argv)))
+	return p.dropped, nil
+}
+
+// BuildVertices lays text out like Print without drawing it, for renderers that batch text with their own geometry.
+// It returns the quads as triangles of vertices x, y, u, v, positions in pixels with y pointing down, and the
+// glyph atlas texture to sample the coverage from its red channel. Background boxes come first, underlines and
+// strikethroughs are included. Glyphs from fallback fonts and color glyphs sample other textures and are left out.
+// Loading missing glyphs uploads them to the atlas, so it must be called on the OpenGL thread.
+// The texture coordinates hold until later text loads glyphs that grow the atlas, or SetMaxGlyphs evicts glyphs.
+// Build the vertices again then, or Preload all glyphs the text uses up front.
+func (f *Font) BuildVertices(x, y, scale float32, text string) ([]float32, uint32) {
+	indices := []rune(text)
+	vertices := make([]float32, 0, len(indices)*floatsPerGlyph)
+	p := newPen(x, y)
+	vertices = f.appendQuads(vertices, p, scale, indices)
+	vertices = append(p.background, vertices...)
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return vertices, f.atlas.texture
+}
+
+// print draws runes starting at the pen and returns it moved after the last glyph.
+func (f *Font) print(p *pen, scale float32, indices []rune) *pen {
+	if len(indices) == 0 {
+		return p
+	}
+
+	// collect the quads of the whole string
+	vertices := f.appendQuads(f.vertices[:0], p, scale, indices)
+	f.vertices = vertices
+
+	f.draw(vertices, p, f.color, identity)
+	return p
+}
+
+// PrintfRotated draws a string like Printf, rotated by radians around the pen start (x, y).
+// Positive angles turn the text clockwise on screen.
+func (f *Font) PrintfRotated(x, y, scale, radians float32, fs string, argv ...interface{}) error {
+
+	indices := []rune(format(fs, argv))
+
+	if len(indices) == 0 {
+		return nil
+	}
+
+	// lay the string out around the origin, the shader rotates it into place
+	vertices := make([]float32, 0, len(indices)*floatsPerGlyph)
+	p := newPen(0, 0)
+	vertices = f.appendQuads(vertices, p, scale, indices)
+
+	f.draw(vertices, p, f.color, rotation(x, y, radians))
+	return nil
+}
+
+// PrintfScaled draws a string like Printf, stretched by scaleX horizontally and scaleY vertically,
+// for condensed or expanded text. Glyphs, spacing and the pen advance scale with scaleX, glyph and line heights
+// with scaleY. Width(scaleX, ...) measures it. It returns the pen position after the last glyph.
+func (f *Font) PrintfScaled(x, y, scaleX, scaleY float32, fs string, argv ...interface{}) (float32, float32, error) {
+
+	indices := []rune(format(fs, argv))
+
+	if len(indices) == 0 {
+		return x, y, nil
+	}
+
+	// lay the string out at scale 1 around the origin, the shader stretches it into place
+	vertices := make([]float32, 0, len(indices)*floatsPerGlyph)
+	p := newPen(0, 0)
+	vertices = f.appendQuads(vertices, p, 1, indices)
+
+	f.draw(vertices, p, f.color, stretch(x, y, scaleX, scaleY))
+	return x + p.x*scaleX, y + p.y*scaleY, nil
+}
+
+// Print3D draws text as quads in 3D space, like labels and billboards in a scene. The text is laid out as with Print
+// from the origin of its local space, in units of pixels times scale with y pointing down and the first baseline at y 0.
+// The column major model-view-projection matrix mvp maps that space to clip space in place of SetProjection,
+// flip y in it for worlds where y points up. Depth testing and culling are left as the application set them.
+func (f *Font) Print3D(mvp [16]float32, scale float32, text string) error {
+
+	indices := []rune(text)
+
+	if len(indices) == 0 {
+		return nil
+	}
+
+	vertices := make([]float32, 0, len(indices)*floatsPerGlyph)
+	p := newPen(0, 0)
+	vertices = f.appendQuads(vertices, p, scale, indices)
+
+	// the matrix replaces the font's projection for this string only
+	projection := f.projection
+	f.projection = &mvp
+	f.draw(vertices, p, f.color, identity)
+	f.projection = projection
+	return nil
+}
+
+// PrintfOnArc draws a string like Printf along the circle of radius around (cx, cy), for badges and circular logos.
+// Each glyph sits on the circle with its baseline tangent to it, the pen advance is turned into the angle it spans.
+// The text starts at startAngle in radians, clockwise from the positive x axis, so -Pi/2 starts at the top.
+// With a positive radius it runs clockwise with the glyph tops outwards, with a negative radius counterclockwise
+// with the tops towards the center, for text along the bottom of a circle. Underlines, strikethroughs and
+// backgrounds are not drawn along arcs.
+// TopToBottom text is drawn as with Printf at (cx, cy).
+func (f *Font) PrintfOnArc(cx, cy, radius, startAngle, scale float32, fs string, argv ...interface{}) error {
+	if radius == 0 {
+		return fmt.Errorf("arc radius must not be 0")
+	}
+	if f.direction == TopToBottom {
+		_, _, err := f.Printf(cx, cy, scale, fs, argv...)
+		return err
+	}
+
+	indices := []rune(format(fs, argv))
+
+	if len(indices) == 0 {
+		return nil
+	}
+
+	// lay the string out along the baseline through the origin, then bend each quad onto the circle
+	vertices := make([]float32, 0, len(indices)*floatsPerGlyph)
+	p := newPen(0, 0)
+	p.glyphsOnly = true
+	vertices = f.appendQuads(vertices, p, scale, indices)
+
+	bendQuads(vertices, cx, cy, radius, startAngle)
+	for _, quads := range p.fallback {
+		bendQuads(quads, cx, cy, radius, startAngle)
+	}
+	for _, quads := range p.colored {
+		bendQuads(quads, cx, cy, radius, startAngle)
+	}
+
+	f.draw(vertices, p, f.color, identity)
+	return nil
+}
+
+// PrintfRuns draws a sequence of text runs, each in its own color.
+// The pen carries over from one run to the next, so the runs flow like a single string.
+func (f *Font) PrintfRuns(x, y, scale float32, runs []TextRun) error {
+	p := newPen(x, y)
+
+	for _, run := range runs {
+		indices := []rune(run.Text)
+		vertices := make([]float32, 0, len(indices)*floatsPerGlyph)
+		vertices = f.appendQuads(vertices, p, scale, indices)
+
+		f.draw(vertices, p, newColor(run.Color), identity)
+	}
+
+	return nil
+}
+
+// pen tracks the drawing position while text is laid out.
+type pen struct {
+	x, y         float32 // position of the next glyph
+	lineX, lineY float32 // start of the current line, for newlines
+	prev         rune    // previous rune on the line, for kerning
+	prevAdvance  float32 // advance of the previous rune, for letter spacing
+	baseAdvance  float32 // horizontal advance of the previous rune, for placing combining marks
+	inset        float32 // distance the previous rune was moved into its fixed advance cell
+	dropped      []rune  // runes skipped for lack of a glyph
+	wordSpacing  float32 // extra advance of spaces, for justified lines
+	glyphsOnly   bool    // leave out decorations and backgrounds, for text bent along an arc
+
+	fallback   map[*Font][]float32 // quads of glyphs from fallback fonts, drawn with their atlas
+	colored    map[*Font][]float32 // quads of color glyphs of the font and its fallbacks, drawn with their color atlas
+	background []float32           // quads of the background boxes, drawn below the text
+}
+
+func newPen(x, y float32) *pen {
+	return &pen{x: x, y: y, lineX: x, lineY: y}
+}
+
+// appendQuads lays out runes starting at the pen and appends a textured quad for each glyph to vertices.
+func (f *Font) appendQuads(vertices []float32, p *pen, scale float32, indices []rune) []float32 {
+
+	// load missing glyphs before building any quad, growing an atlas moves the glyphs packed before
+	// to new v coordinates, which the quads already appended would not follow
+	for _, r := range indices {
+		if r != '\n' && r != '\r' && r != '\t' {
+			f.glyphFrom(r)
+		}
+	}
+
+	// start of the text drawn on the current line, for decorations
+	startX := p.x
+
+	// Iterate through all characters in string
+	for i := range indices {
+
+		// get rune
+		runeIndex := indices[i]
+
+		// start a new line
+		if runeIndex == '\n' {
+			vertices = f.appendDecorations(vertices, p, startX, scale)
+			if f.direction == TopToBottom {
+				// columns run from right to left
+				p.x -= f.lineAdvance() * scale
+				p.y = p.lineY
+			} else {
+				p.x = p.lineX
+				p.y += f.lineAdvance() * scale
+			}
+			p.prev = 0
+			startX = p.x
+			continue
+		}
+		if runeIndex == '\r' {
+			continue
+		}
+
+		// move to the next tab stop
+		if runeIndex == '\t' {
+			switch f.direction {
+			case RightToLeft:
+				p.x = p.lineX - f.nextTabStop(p.lineX-p.x, scale)
+			case LeftToRight:
+				p.x = p.lineX + f.nextTabStop(p.x-p.lineX, scale)
+			case TopToBottom:
+				p.y = p.lineY + f.nextTabStop(p.y-p.lineY, scale)
+			}
+			p.prev = 0
+			continue
+		}
+
+		// find rune in fontChar list or a fallback font, loading it if needed
+		ch, src, ok := f.glyphFrom(runeIndex)
+
+		// skip runes that are not in font chacter range
+		if !ok {
+			f.reportMissing(runeIndex)
+			p.dropped = append(p.dropped, runeIndex)
+			continue
+		}
+
+		// glyphs are rasterized at the display resolution, fallback glyphs are sized to match this font
+		glyphScale := f.glyphScale(src) * scale
+
+		// combining marks overlay the previous glyph instead of taking space of their own
+		mark := isMark(runeIndex, ch.advance)
+
+		// horizontal advance, for centering in columns and placing marks
+		bold := f.bold * scale
+		advance := float32((ch.advance>>6))*glyphScale + bold
+
+		if !mark {
+			// move the ink of the first glyph on the line to its start
+			if f.inkAlign && f.direction == LeftToRight && p.x == p.lineX {
+				p.x += f.inkShift(runeIndex, src, scale)
+			}
+
+			// move closer to or away from the previous rune
+			var gap float32
+			if src == f {
+				gap = f.kern(p.prev, runeIndex) * scale
+			}
+			if p.prev != 0 {
+				gap += f.letterGap(p.prevAdvance, scale)
+			}
+			p.prev = runeIndex
+			p.prevAdvance = f.penAdvance(runeIndex, ch.advance, ch.vadvance, src, scale)
+
+			switch f.direction {
+			case RightToLeft:
+				// glyphs run leftwards from x, step over the glyph before drawing it
+				p.x -= gap + p.prevAdvance
+			case LeftToRight:
+				p.x += gap
+			case TopToBottom:
+				p.y += gap
+			}
+		}
+
+		// center the glyph in its cell when the advance is fixed
+		inset := p.inset
+		if !mark {
+			inset = 0
+			if f.monospaced() {
+				inset = (p.prevAdvance - advance) / 2
+			}
+		}
+
+		// calculate position and size for current rune
+		xpos := p.x + inset + float32(ch.bearingH)*glyphScale
+		ypos := p.y - float32(ch.height-ch.bearingV)*glyphScale
+		w := float32(ch.width) * glyphScale
+		h := float32(ch.height) * glyphScale
+
+		baseline := p.y
+
+		if f.direction == TopToBottom {
+			// center the glyph on the column, its cell starts at y
+			xpos = p.x + (advance-w)/2
+			ypos += float32(f.metrics.Ascent>>6) * scale
+			baseline += float32(f.metrics.Ascent>>6) * scale
+		}
+
+		if mark {
+			// place the mark as if the pen had just stepped over the previous glyph
+			xpos = p.x + float32(ch.bearingH-ch.advance>>6)*glyphScale
+			switch f.direction {
+			case LeftToRight:
+				xpos -= inset
+			case RightToLeft:
+				xpos += p.baseAdvance + inset
+			case TopToBottom:
+				xpos += p.baseAdvance
+			}
+			if f.direction == TopToBottom {
+				ypos -= p.prevAdvance
+				baseline -= p.prevAdvance
+			}
+		}
+
+		// line glyphs up with display pixels so they are sampled without blur
+		if f.pixelSnap {
+			ratio := f.pixelRatio()
+			xpos = float32(math.Round(float64(xpos*ratio))) / ratio
+			ypos = float32(math.Round(float64(ypos*ratio))) / ratio
+		}
+
+		// fake italic leans the glyph by moving its top right and its bottom left of the baseline
+		top := f.italic * (baseline - ypos)
+		bottom := f.italic * (baseline - ypos - h)
+
+		// glyphs of fallback fonts and color glyphs sample their own atlas and are drawn separately
+		quads := vertices
+		switch {
+		case ch.colored:
+			quads = p.colored[src]
+		case src != f:
+			quads = p.fallback[src]
+		}
+
+		quads = appendGlyph(quads, ch, xpos, ypos, w, h, top, bottom)
+
+		// fake bold draws the glyph again up to bold pixels to the right, at most a pixel apart,
+		// color bitmaps are drawn as they are
+		copies := int(math.Ceil(float64(bold)))
+		if ch.colored {
+			copies = 0
+		}
+		for c := 1; c <= copies; c++ {
+			dx := bold * float32(c) / float32(copies)
+			quads = appendGlyph(quads, ch, xpos+dx, ypos, w, h, top, bottom)
+		}
+
+		switch {
+		case ch.colored:
+			if p.colored == nil {
+				p.colored = make(map[*Font][]float32)
+			}
+			p.colored[src] = quads
+		case src != f:
+			if p.fallback == nil {
+				p.fallback = make(map[*Font][]float32)
+			}
+			p.fallback[src] = quads
+		default:
+			vertices = quads
+		}
+
+		if mark {
+			continue
+		}
+
+		// Now advance cursors for next glyph
+		p.baseAdvance = advance
+		p.inset = inset
+		switch f.direction {
+		case LeftToRight:
+			p.x += p.prevAdvance
+		case TopToBottom:
+			p.y += p.prevAdvance
+		}
+
+		// widen the gaps between words of justified lines
+		if runeIndex == ' ' {
+			switch f.direction {
+			case RightToLeft:
+				p.x -= p.wordSpacing
+			case LeftToRight:
+				p.x += p.wordSpacing
+			}
+		}
+	}
+
+	return f.appendDecorations(vertices, p, startX, scale)
+}
+
+// penAdvance returns the distance in pixels the pen moves over the glyph of r from src with the given advances
+// in 1/64 glyph pixels. Drawing and measuring both step with it, so drawn text ends where Width says.
+// The bearings only place the glyph image relative to the pen, they do not move it.
+func (f *Font) penAdvance(r rune, advance, vadvance int, src *Font, scale float32) float32 {
+	// glyphs are rasterized at the display resolution, fallback glyphs are sized to match this font
+	glyphScale := f.glyphScale(src) * scale
+
+	if override, ok := f.advanceOverrides[r]; ok && f.direction != TopToBottom {
+		return override * scale
+	}
+
+	if f.monospaced() {
+		return f.fixedAdvance * scale
+	}
+	// vertical text is measured along its columns
+	if f.direction == TopToBottom {
+		return float32(vadvance>>6) * glyphScale
+	}
+	// Advance is number of 1/64 pixels, bitshift by 6 to get value in pixels (2^6 = 64)
+	return float32(advance>>6)*glyphScale + f.bold*scale
+}
+
+// inkShift returns how far the pen moves right so the ink of r from src starts at it, for SetInkAlign.
+func (f *Font) inkShift(r rune, src *Font, scale float32) float32 {
+	bearing, ok := src.leftBearing(r)
+	if !ok || bearing >= 0 {
+		return 0
+	}
+	return -float32(bearing) * f.glyphScale(src) * scale
+}
+
+// monospaced reports whether horizontal text is laid out on fixed advance cells.
+func (f *Font) monospaced() bool {
+	return f.fixedAdvance > 0 && f.direction != TopToBottom
+}
+
+// isMark reports whether a rune with the given advance is drawn over the previous glyph,
+// like combining accents and other glyphs without advance.
+func isMark(r rune, advance int) bool {
+	return advance == 0 || unicode.Is(unicode.Mn, r)
+}
+
+// appendGlyph appends the quad of a glyph at xpos, ypos with size w, h.
+// Its top and bottom edges are shifted right by top and bottom pixels.
+// Empty glyphs, like spaces, have no quad.
+func appendGlyph(vertices []float32, ch character, xpos, ypos, w, h, top, bottom float32) []float32 {
+	if ch.width == 0 || ch.height == 0 {
+		return vertices
+	}
+	return append(vertices,
+		xpos+w+top, ypos, ch.u1, ch.v0,
+		xpos+top, ypos, ch.u0, ch.v0,
+		xpos+bottom, ypos+h, ch.u0, ch.v1,
+
+		xpos+bottom, ypos+h, ch.u0, ch.v1,
+		xpos+w+bottom, ypos+h, ch.u1, ch.v1,
+		xpos+w+top, ypos, ch.u1, ch.v0,
+	)
+}
+
+// appendDecorations appends the lines enabled on the font, underline and strikethrough,
+// for text drawn from x0 to the pen on its baseline. The background box goes to the pen.
+func (f *Font) appendDecorations(vertices []float32, p *pen, x0, scale float32) []float32 {
+	x1, y := p.x, p.y
+	if x0 == x1 || f.direction == TopToBottom || p.glyphsOnly {
+		return vertices
+	}
+
+	if f.background != nil {
+		// as high as the line so boxes line up across glyphs
+		m := f.Metrics()
+		p.background = f.appendLine(p.background, x0, x1, y-m.Ascent*scale, (m.Ascent+m.Descent)*scale)
+	}
+
+	if f.underline {
+		offset, thickness := f.underlineMetrics()
+		vertices = f.appendLine(vertices, x0, x1, y+offset*scale, thickness*scale)
+	}
+	if f.strikethrough {
+		// as thick as the underline, centered on the middle of the x-height
+		_, thickness := f.underlineMetrics()
+		top := y - (f.strikethroughOffset()+thickness/2)*scale
+		vertices = f.appendLine(vertices, x0, x1, top, thickness*scale)
+	}
+	return vertices
+}
+
+// appendLine appends a solid quad from x0 to x1, from y down to y+thickness.
+func (f *Font) appendLine(vertices []float32, x0, x1, y, thickness float32) []float32 {
+	u, v := f.atlas.solidUV()
+	return append(vertices,
+		x1, y, u, v,
+		x0, y, u, v,
+		x0, y+thickness, u, v,
+
+		x0, y+thickness, u, v,
+		x1, y+thickness, u, v,
+		x1, y, u, v,
+	)
+}
+
+// The OpenGL calls draw makes, benchmarks without an OpenGL context replace them.
+var (
+	saveState    = (*glState).save
+	restoreState = (*glState).restore
+	drawQuads    = (*Font).drawFrom
+)
+
+// draw renders glyph quads built by appendQuads, placed by the transform,
+// on top of the background boxes and followed by the glyphs the pen collected from fallback fonts.
+func (f *Font) draw(vertices []float32, p *pen, c color, transform affine) {
+	// leave blending, the program and the bindings as the application had them
+	saveState(&f.saved, f.textureUnit)
+	defer restoreState(&f.saved)
+	// the quads are drawn, the atlases can be repacked
+	defer f.evictAll()
+
+	if f.background != nil {
+		drawQuads(f, f, false, p.background, *f.background, transform, nil)
+	}
+	p.background = p.background[:0]
+
+	f.underlays = [2]*underlay{f.shadow, f.outline}
+	underlays := f.underlays[:]
+	drawQuads(f, f, false, vertices, c, transform, underlays)
+
+	for src, quads := range p.fallback {
+		drawQuads(f, src, false, quads, c, transform, underlays)
+		delete(p.fallback, src)
+	}
+
+	// color glyphs keep their own colors, only the alpha of c fades them
+	for src, quads := range p.colored {
+		drawQuads(f, src, true, quads, c, transform, nil)
+		delete(p.colored, src)
+	}
+}
+
+// evictAll evicts least recently used glyphs of the font and its fallbacks over their SetMaxGlyphs limit.
+func (f *Font) evictAll() {
+	if err := f.evict(); err != nil {
+		logf("glfont: evicting glyphs: %v", err)
+	}
+	for _, fallback := range f.fallbacks {
+		if err := fallback.evict(); err != nil {
+			logf("glfont: evicting glyphs: %v", err)
+		}
+	}
+}
+
+// drawFrom renders glyph quads sampling the atlas of src, which is the font itself or one of its fallbacks,
+// or its color atlas if colored is set. The quads are uploaded once and drawn for every underlay, then in the color c.
+func (f *Font) drawFrom(src *Font, colored bool, vertices []float32, c color, transform affine, underlays []*underlay) {
+	if len(vertices) == 0 {
+		return
+	}
+
+	// setup blending mode
+	gl.Enable(gl.BLEND)
+	// colors are premultiplied with alpha
+	gl.BlendFunc(gl.ONE, gl.ONE_MINUS_SRC_ALPHA)
+
+	// Activate corresponding render state
+	gl.UseProgram(f.program)
+	// set edge gamma
+	gl.Uniform1f(gl.GetUniformLocation(f.program, gl.Str("gamma\x00")), f.gamma)
+	// set glyph format
+	sdf, rgba := int32(0), int32(0)
+	if src.sdf && !colored {
+		sdf = 1
+	}
+	if colored {
+		rgba = 1
+	}
+	gl.Uniform1i(gl.GetUniformLocation(f.program, gl.Str("sdf\x00")), sdf)
+	gl.Uniform1i(gl.GetUniformLocation(f.program, gl.Str("colored\x00")), rgba)
+	// set target color space
+	srgb := int32(0)
+	if f.srgb {
+		srgb = 1
+	}
+	gl.Uniform1i(gl.GetUniformLocation(f.program, gl.Str("srgb\x00")), srgb)
+	// set clip rectangle
+	if f.clip != nil {
+		gl.Uniform4f(gl.GetUniformLocation(f.program, gl.Str("clipRect\x00")), f.clip[0], f.clip[1], f.clip[2], f.clip[3])
+		gl.Uniform1i(gl.GetUniformLocation(f.program, gl.Str("clip\x00")), 1)
+	} else {
+		gl.Uniform1i(gl.GetUniformLocation(f.program, gl.Str("clip\x00")), 0)
+	}
+	// set clip space mapping
+	if f.projection != nil {
+		gl.UniformMatrix4fv(gl.GetUniformLocation(f.program, gl.Str("projection\x00")), 1, false, &f.projection[0])
+		gl.Uniform1i(gl.GetUniformLocation(f.program, gl.Str("useProjection\x00")), 1)
+	} else {
+		gl.Uniform1i(gl.GetUniformLocation(f.program, gl.Str("useProjection\x00")), 0)
+		if f.autoResolution {
+			// map to the current viewport instead of the size passed to UpdateResolution,
+			// fonts sharing the program keep that size, it is set again after drawing
+			resUniform := gl.GetUniformLocation(f.program, gl.Str("resolution\x00"))
+			var viewport [4]int32
+			var resolution [2]float32
+			gl.GetIntegerv(gl.VIEWPORT, &viewport[0])
+			gl.GetUniformfv(f.program, resUniform, &resolution[0])
+			gl.Uniform2f(resUniform, float32(viewport[2]), float32(viewport[3]))
+			defer gl.Uniform2f(resUniform, resolution[0], resolution[1])
+		}
+	}
+
+	gl.ActiveTexture(gl.TEXTURE0 + f.textureUnit)
+	gl.Uniform1i(gl.GetUniformLocation(f.program, gl.Str("tex\x00")), int32(f.textureUnit))
+	gl.BindVertexArray(f.vao)
+	// all glyphs live in the atlas texture
+	texture := src.atlas.texture
+	if colored {
+		texture = src.colorAtlas.texture
+	}
+	gl.BindTexture(gl.TEXTURE_2D, texture)
+
+	// Update content of VBO memory
+	gl.BindBuffer(gl.ARRAY_BUFFER, f.vbo)
+	size := len(vertices) * 4
+	if size > f.vboSize {
+		// grow the buffer to hold the whole string
+		gl.BufferData(gl.ARRAY_BUFFER, size, gl.Ptr(&vertices[0]), gl.DYNAMIC_DRAW)
+		f.vboSize = size
+	} else {
+		gl.BufferSubData(gl.ARRAY_BUFFER, 0, size, gl.Ptr(&vertices[0]))
+	}
+
+	// Render all quads at once
+	pass := func(c color, t affine) {
+		// set text color
+		gl.Uniform4f(gl.GetUniformLocation(f.program, gl.Str("textColor\x00")), c.r, c.g, c.b, c.a)
+		// set text placement
+		f.matrix = t
+		gl.UniformMatrix3fv(gl.GetUniformLocation(f.program, gl.Str("transform\x00")), 1, false, &f.matrix[0])
+		gl.DrawArrays(gl.TRIANGLES, 0, int32(len(vertices)/floatsPerVertex))
+	}
+
+	// the same quads are drawn offset below the text for the shadow and the outline
+	for _, u := range underlays {
+		if u == nil {
+			continue
+		}
+		for _, offset := range u.offsets {
+			pass(u.color, transform.translate(offset[0], offset[1]))
+		}
+	}
+	pass(c, transform)
+}
+
+// PrintfAligned draws a string like Printf, aligned horizontally to x.
+// Each line of multi-line text is aligned on its own.
+// TopToBottom text is drawn as with Printf.
+func (f *Font) PrintfAligned(x, y, scale float32, align Align, fs string, argv ...interface{}) error {
+	text := format(fs, argv)
+
+	if f.direction == TopToBottom {
+		_, _, err := f.Printf(x, y, scale, "%s", text)
+		return err
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		width := f.Width(scale, "%s", line)
+
+		lineX := x
+		switch align {
+		case AlignCenter:
+			lineX -= width / 2
+		case AlignRight:
+			lineX -= width
+		}
+
+		// right-to-left text is drawn leftwards from its right edge
+		if f.direction == RightToLeft {
+			lineX += width
+		}
+
+		_, _, err := f.Printf(lineX, y, scale, "%s", line)
+		if err != nil {
+			return err
+		}
+		y += f.lineAdvance() * scale
+	}
+
+	return nil
+}
+
+// PrintfInBox draws a string aligned in the box at boxX, boxY of size boxW, boxH,
+// horizontally by hAlign and vertically by vAlign. The text is placed by the font's ascent and descent
+// rather than the height of its glyphs, so labels of different text line up in boxes of equal size.
+// Multi-line text is aligned as a block of lines, each line aligned horizontally on its own.
+func (f *Font) PrintfInBox(boxX, boxY, boxW, boxH, scale float32, hAlign Align, vAlign VAlign, fs string, argv ...interface{}) error {
+	text := format(fs, argv)
+
+	x := boxX
+	switch hAlign {
+	case AlignCenter:
+		x += boxW / 2
+	case AlignRight:
+		x += boxW
+	}
+
+	// the block reaches from the ascent of the first line to the descent of the last
+	m := f.Metrics()
+	lines := float32(strings.Count(text, "\n"))
+	height := (m.Ascent+m.Descent)*scale + lines*f.lineAdvance()*scale
+
+	y := boxY
+	switch vAlign {
+	case VAlignMiddle:
+		y += (boxH - height) / 2
+	case VAlignBottom:
+		y += boxH - height
+	}
+
+	return f.PrintfAligned(x, y+m.Ascent*scale, scale, hAlign, "%s", text)
+}
+
+// DrawFitted draws text at the largest scale that fits the box at x, y of size w, h, see FitScale.
+// It is aligned horizontally by align and centered vertically, placed by the font's ascent and descent like PrintfInBox.
+func (f *Font) DrawFitted(x, y, w, h float32, text string, align Align) error {
+	scale := f.FitScale(text, w, h)
+	return f.PrintfInBox(x, y, w, h, scale, align, VAlignMiddle, "%s", text)
+}
+
+// PrintfWrapped draws a string like Printf, breaking it into lines no wider than maxWidth.
+// Lines are broken on spaces, a word wider than maxWidth is drawn on a line of its own.
+// It returns the number of lines drawn.
+func (f *Font) PrintfWrapped(x, y, scale, maxWidth float32, fs string, argv ...interface{}) (int, error) {
+	lines := f.WrapLines(scale, maxWidth, format(fs, argv))
+	f.DrawLines(x, y, scale, lines)
+	return len(lines), nil
+}
+
+// PrintfWrappedAligned draws a string wrapped like PrintfWrapped, each line aligned in the column
+// from x to x+maxWidth. AlignJustify spreads the space left on a line evenly over its spaces,
+// the last line of each paragraph and lines of a single word are left aligned.
+// TopToBottom text is drawn as with PrintfWrapped. It returns the number of lines drawn.
+func (f *Font) PrintfWrappedAligned(x, y, scale, maxWidth float32, align Align, fs string, argv ...interface{}) (int, error) {
+	text := format(fs, argv)
+
+	if f.direction == TopToBottom {
+		return f.PrintfWrapped(x, y, scale, maxWidth, "%s", text)
+	}
+
+	count := 0
+	for _, paragraph := range strings.Split(text, "\n") {
+		lines := f.WrapLines(scale, maxWidth, paragraph)
+		for i, line := range lines {
+			width := f.Width(scale, "%s", line)
+
+			p := newPen(x, y)
+			switch align {
+			case AlignCenter:
+				p.x += (maxWidth - width) / 2
+			case AlignRight:
+				p.x += maxWidth - width
+			case AlignJustify:
+				// every space of the line gets an even share of the room left
+				gaps := strings.Count(line, " ")
+				if i < len(lines)-1 && gaps > 0 && width < maxWidth {
+					p.wordSpacing = (maxWidth - width) / float32(gaps)
+					width = maxWidth
+				}
+			}
+
+			// right-to-left text is drawn leftwards from its right edge
+			if f.direction == RightToLeft {
+				p.x += width
+			}
+			p.lineX = p.x
+
+			f.print(p, scale, []rune(line))
+			y += f.lineAdvance() * scale
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// DrawLines draws lines of text, e.g. from WrapLines, one below the other starting at x, y.
+// Lines are one line height times the line spacing apart. It returns the y of the line after the last one.
+func (f *Font) DrawLines(x, y, scale float32, lines []string) float32 {
+	for _, line := range lines {
+		f.Print(x, y, scale, line)
+		y += f.lineAdvance() * scale
+	}
+	return y
+}
+
+// WrapLines breaks text into the lines PrintfWrapped would draw, without drawing them.
+// Lines are filled greedily up to maxWidth, newlines in the text always start a new line.
+// Lines are broken only at ASCII spaces, which are dropped at the break, a no-break space
+// keeps the words around it together. Indentation, tabs and runs of spaces within a line are kept.
+func (f *Font) WrapLines(scale, maxWidth float32, text string) []string {
+	var lines []string
+
+	for _, paragraph := range strings.Split(text, "\n") {
+		// the line is paragraph[start:end], end is at the last word added to it
+		start, end := 0, 0
+		words := false
+		for i := 0; i < len(paragraph); {
+			if paragraph[i] == ' ' {
+				i++
+				continue
+			}
+			wordStart := i
+			for i < len(paragraph) && paragraph[i] != ' ' {
+				i++
+			}
+
+			// start a new line when the word does not fit anymore
+			if words && f.Width(scale, "%s", paragraph[start:i]) > maxWidth {
+				lines = append(lines, paragraph[start:end])
+				start = wordStart
+			}
+			end = i
+			words = true
+		}
+		lines = append(lines, paragraph[start:end])
+	}
+
+	return lines
+}
+
+// Width returns the width of a piece of text in pixels.
+// For text spanning several lines the width of the widest line is returned.
+// For TopToBottom fonts it is the height of the tallest column.
+// Width does not rasterize glyphs or make OpenGL calls, it can measure text on any goroutine.
+// It measures how far Printf moves the pen, glyphs with large side bearings may reach a little past it.
+func (f *Font) Width(scale float32, fs string, argv ...interface{}) float32 {
+	return f.measure(scale, []rune(format(fs, argv)), nil)
+}
+
+// LayoutRunes returns the placement of each rune of text drawn with Printf at x, y, in the order of the text,
+// for hit testing, carets and selections. Positions step like the pen does when drawing, with kerning,
+// letter spacing and tabs. A newline is placed at the end of the line it ends. Like Width it makes no OpenGL calls.
+// For RightToLeft text X is the left edge of the rune's advance.
+func (f *Font) LayoutRunes(x, y, scale float32, text string) []GlyphPlacement {
+	runes := []rune(text)
+	placements := make([]GlyphPlacement, len(runes))
+
+	// end of the last rune on the line, where a newline is placed
+	var line int
+	var end float32
+	f.measure(scale, runes, func(i int, lineWidth, advance float32) {
+		start := lineWidth - advance
+		if runes[i] == '\n' {
+			start, lineWidth = end, end
+		}
+		end = lineWidth
+
+		p := GlyphPlacement{Rune: runes[i], Advance: advance}
+		lineOffset := float32(line) * f.lineAdvance() * scale
+		switch f.direction {
+		case LeftToRight:
+			p.X, p.Y = x+start, y+lineOffset
+		case RightToLeft:
+			p.X, p.Y = x-lineWidth, y+lineOffset
+		case TopToBottom:
+			p.X, p.Y = x-lineOffset, y+start
+		}
+		placements[i] = p
+
+		if runes[i] == '\n' {
+			line++
+			end = 0
+		}
+	})
+	return placements
+}
+
+// CaretOffset returns the distance in pixels from the start of its line to a caret before
+// the rune at index, counted in runes, for drawing a text cursor. The distance is measured in
+// the direction of the text and includes kerning, letter spacing and tabs like Printf.
+// An index past the end of text places the caret after its last rune.
+func (f *Font) CaretOffset(scale float32, text string, index int) float32 {
+	var offset float32
+	f.measure(scale, []rune(text), func(i int, lineWidth, _ float32) {
+		// the caret follows the rune before it, a newline moves it to the next line
+		if i < index {
+			offset = lineWidth
+		}
+	})
+	return offset
+}
+
+// IndexAtOffset returns the caret index, counted in runes, closest to offset pixels from the start
+// of a line of text, for placing the caret where the text was clicked. It is the inverse of CaretOffset
+// on the first line, the index of the newline ending it if offset is past its end.
+func (f *Font) IndexAtOffset(scale float32, text string, offset float32) int {
+	runes := []rune(text)
+	index := len(runes)
+	found := false
+	f.measure(scale, runes, func(i int, lineWidth, advance float32) {
+		if found || (advance == 0 && runes[i] != '\n') {
+			return
+		}
+		// before the middle of a rune the caret goes in front of it
+		if runes[i] == '\n' || offset < lineWidth-advance/2 {
+			index, found = i, true
+		}
+	})
+	return index
+}
+
+// DigitWidth returns the largest advance of the digits 0 to 9 in pixels, the width a digit takes in
+// Printf. Reserving it per digit keeps changing numbers, like a score or a frame rate, from moving
+// the text around them. Like Width it makes no OpenGL calls.
+func (f *Font) DigitWidth(scale float32) float32 {
+	var width float32
+	for r := '0'; r <= '9'; r++ {
+		advance, vadvance, src, ok := f.advances(r)
+		if !ok {
+			continue
+		}
+		width = max32(width, f.penAdvance(r, advance, vadvance, src, scale))
+	}
+	return width
+}
+
+// measure returns the width of the widest line of runes in pixels.
+// If visit is set it is called after each rune with the width of its line so far
+// and the advance of the rune, the pen stepped over it from lineWidth-advance.
+func (f *Font) measure(scale float32, indices []rune, visit func(i int, lineWidth, advance float32)) float32 {
+
+	var width, lineWidth float32
+	// previous rune on the line and its advance, for kerning and letter spacing
+	var prev rune
+	var prevAdvance float32
+
+	if len(indices) == 0 {
+		return 0
+	}
+
+	// report the line width once the rune is handled, whichever way the loop continues
+	report := func(i int, advance float32) {
+		if visit != nil {
+			visit(i, lineWidth, advance)
+		}
+	}
+
+	// Iterate through all characters in string
+	for i := range indices {
+
+		// get rune
+		runeIndex := indices[i]
+
+		// start a new line
+		if runeIndex == '\n' {
+			lineWidth = 0
+			prev = 0
+			report(i, 0)
+			continue
+		}
+		if runeIndex == '\r' {
+			report(i, 0)
+			continue
+		}
+
+		// move to the next tab stop
+		if runeIndex == '\t' {
+			tab := lineWidth
+			lineWidth = f.nextTabStop(lineWidth, scale)
+			if lineWidth > width {
+				width = lineWidth
+			}
+			prev = 0
+			report(i, lineWidth-tab)
+			continue
+		}
+
+		// find the advances of the rune in this font or a fallback font, without rasterizing it
+		advance, vadvance, src, ok := f.advances(runeIndex)
+
+		// skip runes that are not in font chacter range
+		if !ok {
+			f.reportMissing(runeIndex)
+			report(i, 0)
+			continue
+		}
+
+		// combining marks take no space
+		if isMark(runeIndex, advance) {
+			report(i, 0)
+			continue
+		}
+
+		// the first glyph on the line is moved to start its ink at the pen
+		if f.inkAlign && f.direction == LeftToRight && lineWidth == 0 {
+			lineWidth += f.inkShift(runeIndex, src, scale)
+		}
+
+		// space between this rune and the previous one
+		if src == f {
+			lineWidth += f.kern(prev, runeIndex) * scale
+		}
+		if prev != 0 {
+			lineWidth += f.letterGap(prevAdvance, scale)
+		}
+		prev = runeIndex
+
+		// Now advance cursors for next glyph, the same step the pen takes when drawing
+		prevAdvance = f.penAdvance(runeIndex, advance, vadvance, src, scale)
+
+		lineWidth += prevAdvance
+		if lineWidth > width {
+			width = lineWidth
+		}
+		report(i, prevAdvance)
+	}
+
+	// leave room for the top of a fake italic glyph leaning past the end of the line
+	if width > 0 {
+		width += f.overhang(scale)
+	}
+
+	return width
+}
+
+// overhang returns how far the top of a fake italic glyph leans past its advance in pixels.
+// Text on the grid of a fixed advance keeps the width of its cells, italic glyphs lean into the next cell.
+func (f *Font) overhang(scale float32) float32 {
+	if f.italic <= 0 || f.direction == TopToBottom || f.fixedAdvance > 0 {
+		return 0
+	}
+	return f.italic * float32(f.metrics.Ascent>>6) * scale
+}
+
+// ellipsis is appended to text shortened by TruncateToWidth.
+const ellipsis = "…"
+
+// TruncateToWidth shortens each line of text that is wider than maxWidth, cutting runes
+// from its end and appending an ellipsis so it fits. Lines that fit are returned unchanged.
+func (f *Font) TruncateToWidth(scale, maxWidth float32, text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = f.truncateLine(scale, maxWidth, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// truncateLine shortens a single line for TruncateToWidth, measuring it once.
+func (f *Font) truncateLine(scale, maxWidth float32, line string) string {
+	runes := []rune(line)
+
+	// width of the line up to and including each rune
+	prefix := make([]float32, len(runes))
+	width := f.measure(scale, runes, func(i int, lineWidth, _ float32) {
+		prefix[i] = lineWidth
+	})
+	if width <= maxWidth {
+		return line
+	}
+
+	// keep the longest start that still fits next to the ellipsis, its width includes the italic overhang
+	room := maxWidth - f.measure(scale, []rune(ellipsis), nil)
+	n := len(runes)
+	for n > 0 && prefix[n-1] > room {
+		n--
+	}
+
+	return strings.TrimRight(string(runes[:n]), " \t") + ellipsis
+}
+
+// PrintfEllipsis draws a string like Printf, shortened with an ellipsis if it is wider than maxWidth.
+// Each line of multi-line text is shortened on its own.
+func (f *Font) PrintfEllipsis(x, y, scale, maxWidth float32, fs string, argv ...interface{}) error {
+	text := f.TruncateToWidth(scale, maxWidth, format(fs, argv))
+	_, _, err := f.Print(x, y, scale, text)
+	return err
+}
+
+// WidthRuns returns the width of a sequence of text runs in pixels, as drawn by PrintfRuns.
+func (f *Font) WidthRuns(scale float32, runs []TextRun) float32 {
+	var text strings.Builder
+	for _, run := range runs {
+		text.WriteString(run.Text)
+	}
+
+	return f.Width(scale, "%s", text.String())
+}
+
+// Height returns the height of a line of text in pixels, ascent plus descent plus line gap, at the given scale.
+func (f *Font) Height(scale float32) float32 {
+	return f.lineHeight() * scale
+}
+
+// TextHeight returns the height of a piece of text in pixels. Each line after the first
+// adds the line height times the line spacing.
+func (f *Font) TextHeight(scale float32, fs string, argv ...interface{}) float32 {
+	text := format(fs, argv)
+	if text == "" {
+		return 0
+	}
+
+	lines := float32(strings.Count(text, "\n"))
+	return f.Height(scale) + lines*f.lineAdvance()*scale
+}
+
+// BoundingBox returns the width and height of a piece of text in pixels.
+// The height is the TextHeight of the text, the line spacing only adds to the lines after the first.
+func (f *Font) BoundingBox(scale float32, fs string, argv ...interface{}) (w, h float32) {
+	text := format(fs, argv)
+	length := f.Width(scale, "%s", text)
+	height := f.TextHeight(scale, "%s", text)
+
+	// vertical text stacks its lines as columns
+	if f.direction == TopToBottom {
+		return height, length
+	}
+	return length, height
+}
+
+// FitScale returns the largest scale at which text fits maxWidth and, if maxHeight is above 0, maxHeight.
+// Text is measured like Width, its height reaches from the ascent of the first line to the descent of the last,
+// as PrintfInBox places it. Both grow linearly with the scale. Empty text fits at any scale, 1 is returned for it.
+func (f *Font) FitScale(text string, maxWidth, maxHeight float32) float32 {
+	w, h := f.BoundingBox(1, "%s", text)
+	if f.direction != TopToBottom && text != "" {
+		m := f.Metrics()
+		h = m.Ascent + m.Descent + float32(strings.Count(text, "\n"))*f.lineAdvance()
+	}
+
+	scale := float32(math.Inf(1))
+	if w > 0 {
+		scale = maxWidth / w
+	}
+	if maxHeight > 0 && h > 0 && maxHeight/h < scale {
+		scale = maxHeight / h
+	}
+	if math.IsInf(float64(scale), 1) {
+		return 1
+	}
+	return scale
+}
+
+// Clone returns a font sharing the glyph atlas, the parsed font and the shader program of f,
+// with its own copy of the color, spacing, decoration and other drawing settings.
+// Drawing the same text in several colors with clones saves loading the font again.
+// Settings that change the glyphs, SetScale, SetDPI, SetHinting, SetSDF, SetAntialias, SetAtlasPadding, SetBakedColor,
+// SetFilter, SetMipmaps, SetMaxGlyphs and Reload, apply to f and all its clones.
+// Shared resources are deleted when the last of them is released.
+func (f *Font) Clone() *Font {
+	f.mu.Lock()
+	f.refs++
+	f.mu.Unlock()
+
+	c := *f
+	c.fallbacks = append([]*Font(nil), f.fallbacks...)
+	c.runes, c.vertices, c.pen = nil, nil, pen{}
+	c.advanceOverrides = make(map[rune]float32, len(f.advanceOverrides))
+	for r, advance := range f.advanceOverrides {
+		c.advanceOverrides[r] = advance
+	}
+	retainProgram(c.program)
+	c.newBuffers()
+	return &c
+}
+
+// Release deletes the glyph atlas texture, buffers and shader program owned by the font.
+// The default program shared by fonts from LoadFont and LoadFontBytes, and the atlas and program
+// a font shares with its clones, and buffers shared with ShareBuffers, are deleted with the last of them. Calling Release more than once is a no-op.
+func (f *Font) Release() {
+	if f.buffers == nil {
+		return
+	}
+
+	// the glyphs are deleted with the last font sharing them
+	f.mu.Lock()
+	f.refs--
+	if f.refs == 0 {
+		f.atlas.release()
+		if f.colorAtlas != nil {
+			f.colorAtlas.release()
+			f.colorAtlas = nil
+		}
+		f.fontChar = make(map[rune]*character)
+	}
+	f.mu.Unlock()
+
+	f.releaseBuffers()
+	releaseProgram(f.program)
+	f.program = 0
 }
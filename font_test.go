@@ -0,0 +1,467 @@
+package glfont
+
+import (
+	"encoding/binary"
+	"image"
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// newTestFont builds a font from ttf data with the settings LoadTrueTypeFont gives it, without OpenGL objects.
+// It can measure and lay out text, glyphs have to be put in the cache with cacheGlyphs before laying out quads.
+func newTestFont(tb testing.TB, data []byte, scale int32) *Font {
+	tb.Helper()
+
+	f, err := newFont(data, scale, LeftToRight)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return f
+}
+
+// cacheGlyphs stores the glyphs of text in the cache with the metrics GenerateGlyphs gives them, from glyphMetrics,
+// without rasterizing them into an atlas, so appendQuads finds them without loading.
+func cacheGlyphs(tb testing.TB, f *Font, text string) {
+	tb.Helper()
+
+	for _, r := range text {
+		if _, ok := f.fontChar[r]; ok || r == '\n' || r == '\r' || r == '\t' {
+			continue
+		}
+		if !f.hasGlyph(r) {
+			f.fontChar[r] = &character{missing: true}
+			continue
+		}
+
+		char, ok := f.glyphMetrics(r)
+		if !ok {
+			tb.Fatalf("no bounds for %q", r)
+		}
+		f.fontChar[r] = char
+	}
+}
+
+// quadBounds returns the left, top, right and bottom edges of the quad of glyph i in vertices.
+func quadBounds(vertices []float32, i int) (left, top, right, bottom float32) {
+	quad := vertices[i*floatsPerGlyph : (i+1)*floatsPerGlyph]
+	left, top, right, bottom = quad[0], quad[1], quad[0], quad[1]
+	for v := floatsPerVertex; v < len(quad); v += floatsPerVertex {
+		left, right = min32(left, quad[v]), max32(right, quad[v])
+		top, bottom = min32(top, quad[v+1]), max32(bottom, quad[v+1])
+	}
+	return left, top, right, bottom
+}
+
+func min32(a, b float32) float32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func TestWidthOfRunesAboveFirstBatch(t *testing.T) {
+	f := newTestFont(t, goregular.TTF, 20)
+
+	for _, r := range []rune{'A', '€'} {
+		g, ok := f.Glyph(r)
+		if !ok {
+			t.Fatalf("Glyph(%q) not found", r)
+		}
+		if got := f.Width(1, "%c", r); got != g.Advance || got <= 0 {
+			t.Errorf("Width(%q) = %v, want its advance %v", r, got, g.Advance)
+		}
+	}
+
+	a, euro := f.Width(1, "A"), f.Width(1, "€")
+	if got := f.Width(1, "A€"); got != a+euro {
+		t.Errorf("Width(\"A€\") = %v, want %v", got, a+euro)
+	}
+}
+
+func TestGlyphLoadsAlignedBatch(t *testing.T) {
+	f := newTestFont(t, goregular.TTF, 20)
+
+	// load batches with the metrics of GenerateGlyphs, without an atlas
+	var batches [][2]rune
+	defer func(load func(*Font, rune, rune) error) { loadBatch = load }(loadBatch)
+	loadBatch = func(f *Font, low, high rune) error {
+		batches = append(batches, [2]rune{low, high})
+		var runes []rune
+		for r := low; r <= high; r++ {
+			runes = append(runes, r)
+		}
+		cacheGlyphs(t, f, string(runes))
+		return nil
+	}
+
+	for _, r := range []rune{'A', 'B', '€'} {
+		if _, ok := f.glyph(r); !ok {
+			t.Fatalf("glyph(%q) not found", r)
+		}
+	}
+
+	want := [][2]rune{{64, 95}, {0x20A0, 0x20BF}}
+	if !reflect.DeepEqual(batches, want) {
+		t.Fatalf("loaded batches %U, want %U", batches, want)
+	}
+	for _, batch := range want {
+		for r := batch[0] - 1; r <= batch[1]+1; r++ {
+			loaded := f.cached(r)
+			if inside := r >= batch[0] && r <= batch[1]; loaded != inside {
+				t.Errorf("%U cached %v after loading %U to %U", r, loaded, batch[0], batch[1])
+			}
+		}
+	}
+}
+
+func TestPrintfWithoutArgsKeepsPercent(t *testing.T) {
+	f := newTestFont(t, goregular.TTF, 20)
+
+	text := format("100%", nil)
+	var got []rune
+	for _, p := range f.LayoutRunes(0, 0, 1, text) {
+		got = append(got, p.Rune)
+	}
+	if string(got) != "100%" {
+		t.Errorf("laid out %q, want \"100%%\"", string(got))
+	}
+
+	want := f.Width(1, "%s", "100") + f.Width(1, "%s", "%")
+	if w := f.Width(1, "100%"); w != want {
+		t.Errorf("Width(\"100%%\") = %v, want %v", w, want)
+	}
+}
+
+func TestDescendersShareTheBaseline(t *testing.T) {
+	f := newTestFont(t, goregular.TTF, 20)
+	text := "abcdegjpqy"
+	cacheGlyphs(t, f, text)
+
+	for _, p := range f.LayoutRunes(10, 50, 1, text) {
+		if p.Y != 50 {
+			t.Errorf("%q laid out on y %v, want the baseline 50", p.Rune, p.Y)
+		}
+	}
+
+	// glyphs without descenders end on the baseline, descenders reach below it
+	vertices := f.appendQuads(nil, newPen(10, 50), 1, []rune(text))
+	for i, r := range text {
+		_, _, _, bottom := quadBounds(vertices, i)
+		g, _ := f.Glyph(r)
+		if want := 50 + g.BearingV; bottom != want {
+			t.Errorf("%q bottom at %v, want %v", r, bottom, want)
+		}
+		if descends := bottom > 50; descends != (i >= 5) {
+			t.Errorf("%q bottom at %v, below the baseline %v", r, bottom, descends)
+		}
+	}
+}
+
+func TestPenEndMatchesWidth(t *testing.T) {
+	f := newTestFont(t, goitalic.TTF, 40)
+	text := "fjord jiffy fog"
+	cacheGlyphs(t, f, text)
+
+	negative := false
+	for _, r := range text {
+		g, _ := f.Glyph(r)
+		negative = negative || g.BearingH < 0
+	}
+	if !negative {
+		t.Fatalf("no glyph of %q has a negative left side bearing", text)
+	}
+
+	for _, scale := range []float32{1, 0.5, 2} {
+		width := f.Width(scale, "%s", text)
+
+		p := newPen(10, 50)
+		f.appendQuads(nil, p, scale, []rune(text))
+		if got := p.x - 10; got != width {
+			t.Errorf("scale %v: pen moved %v, Width is %v", scale, got, width)
+		}
+
+		placements := f.LayoutRunes(10, 50, scale, text)
+		last := placements[len(placements)-1]
+		if got := last.X + last.Advance - 10; got != width {
+			t.Errorf("scale %v: layout ends at %v, Width is %v", scale, got, width)
+		}
+	}
+}
+
+func TestRuneAboveBMPWithoutGlyphIsSkipped(t *testing.T) {
+	f := newTestFont(t, goregular.TTF, 20)
+	text := "a\U0001F600b"
+	cacheGlyphs(t, f, text)
+
+	var missing []rune
+	f.SetMissingGlyphFunc(func(r rune) { missing = append(missing, r) })
+
+	if got, want := f.Width(1, "%s", text), f.Width(1, "ab"); got != want {
+		t.Errorf("Width(%q) = %v, want %v as without the emoji", text, got, want)
+	}
+	if len(missing) != 1 || missing[0] != 0x1F600 {
+		t.Errorf("reported missing %U, want [U+1F600]", missing)
+	}
+
+	p := newPen(0, 20)
+	vertices := f.appendQuads(nil, p, 1, []rune(text))
+	if len(vertices) != 2*floatsPerGlyph {
+		t.Errorf("%d quads for %q, want 2", len(vertices)/floatsPerGlyph, text)
+	}
+	if len(p.dropped) != 1 || p.dropped[0] != 0x1F600 {
+		t.Errorf("dropped %U, want [U+1F600]", p.dropped)
+	}
+
+	// runes outside Unicode have no glyph and load nothing
+	for _, r := range []rune{-1, unicode.MaxRune + 1, 0x7FFFFFFF} {
+		if _, ok := f.glyph(r); ok {
+			t.Errorf("glyph(%d) found", r)
+		}
+	}
+}
+
+// iconFont returns data with the cmap table replaced to map printable ASCII as before and each private use
+// code point of icons to the glyph of its rune, like an icon font keeps its glyphs in the Private Use Area.
+func iconFont(tb testing.TB, data []byte, icons map[rune]rune) []byte {
+	tb.Helper()
+
+	f := newTestFont(tb, data, 20)
+	index := map[rune]uint32{}
+	for r := rune(32); r < 127; r++ {
+		index[r] = uint32(f.ttf.Index(r))
+	}
+	for icon, r := range icons {
+		index[icon] = uint32(f.ttf.Index(r))
+	}
+	runes := make([]rune, 0, len(index))
+	for r := range index {
+		runes = append(runes, r)
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+
+	u16 := func(b []byte, v uint16) []byte { return append(b, byte(v>>8), byte(v)) }
+	u32 := func(b []byte, v uint32) []byte { return u16(u16(b, uint16(v>>16)), uint16(v)) }
+
+	// a format 12 subtable, one group per rune, for Windows Unicode full repertoire
+	cmap := u16(nil, 0)
+	cmap = u16(cmap, 1)
+	cmap = u16(cmap, 3)
+	cmap = u16(cmap, 10)
+	cmap = u32(cmap, 12)
+	cmap = u16(cmap, 12)
+	cmap = u16(cmap, 0)
+	cmap = u32(cmap, uint32(16+12*len(runes)))
+	cmap = u32(cmap, 0)
+	cmap = u32(cmap, uint32(len(runes)))
+	for _, r := range runes {
+		cmap = u32(cmap, uint32(r))
+		cmap = u32(cmap, uint32(r))
+		cmap = u32(cmap, index[r])
+	}
+
+	// copy the tables behind the table records, the cmap replaced
+	numTables := int(binary.BigEndian.Uint16(data[4:]))
+	header := 12 + 16*numTables
+	out := append([]byte(nil), data[:header]...)
+	for i := 0; i < numTables; i++ {
+		record := out[12+16*i:]
+		table := data[binary.BigEndian.Uint32(record[8:]):][:binary.BigEndian.Uint32(record[12:])]
+		if string(record[:4]) == "cmap" {
+			table = cmap
+		}
+		binary.BigEndian.PutUint32(record[8:], uint32(len(out)))
+		binary.BigEndian.PutUint32(record[12:], uint32(len(table)))
+		out = append(out, table...)
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+	}
+	return out
+}
+
+func TestPrivateUseAreaGlyphsKeepTheirBounds(t *testing.T) {
+	icons := map[rune]rune{0xE000: 'g', 0xF015: 'M'}
+	text := newTestFont(t, goregular.TTF, 20)
+	icon := newTestFont(t, iconFont(t, goregular.TTF, icons), 20)
+	text.AddFallback(icon)
+
+	for pua, r := range icons {
+		if text.HasGlyph(pua) || !icon.HasGlyph(pua) {
+			t.Fatalf("%U should only be in the icon font", pua)
+		}
+
+		// the icon glyph has the bounds of the glyph it was mapped from
+		want, _ := text.Glyph(r)
+		got, ok := icon.Glyph(pua)
+		if !ok || got != want {
+			t.Errorf("Glyph(%U) = %+v, %v, want %+v", pua, got, ok, want)
+		}
+		if got.Width <= 1 || got.Height <= 1 {
+			t.Errorf("Glyph(%U) is %vx%v", pua, got.Width, got.Height)
+		}
+
+		// text with the icon is drawn from the fallback at full size
+		s := string([]rune{'a', pua})
+		cacheGlyphs(t, text, s)
+		cacheGlyphs(t, icon, s[1:])
+		p := newPen(0, 20)
+		text.appendQuads(nil, p, 1, []rune(s))
+		quads := p.fallback[icon]
+		if len(quads) != floatsPerGlyph || len(p.dropped) != 0 {
+			t.Fatalf("%q: %d fallback quads, dropped %U", s, len(quads)/floatsPerGlyph, p.dropped)
+		}
+		left, top, right, bottom := quadBounds(quads, 0)
+		if right-left != want.Width || bottom-top != want.Height {
+			t.Errorf("%U drawn %vx%v, want %vx%v", pua, right-left, bottom-top, want.Width, want.Height)
+		}
+		if w := text.Width(1, "%s", s); w != text.Width(1, "a")+want.Advance {
+			t.Errorf("Width(%q) = %v, want %v", s, w, text.Width(1, "a")+want.Advance)
+		}
+	}
+}
+
+// BenchmarkPrint runs Print with the OpenGL calls of draw replaced, it needs no OpenGL context.
+// Once the font's rune and vertex buffers have grown to the text it allocates nothing.
+func BenchmarkPrint(b *testing.B) {
+	f := newTestFont(b, goregular.TTF, 20)
+	text := "The quick brown fox jumps over the lazy dog 0123456789"
+	cacheGlyphs(b, f, text)
+
+	defer func(save func(*glState, uint32), restore func(*glState)) {
+		saveState, restoreState = save, restore
+	}(saveState, restoreState)
+	defer func(draw func(*Font, *Font, bool, []float32, color, affine, []*underlay)) { drawQuads = draw }(drawQuads)
+	saveState = func(*glState, uint32) {}
+	restoreState = func(*glState) {}
+	drawQuads = func(*Font, *Font, bool, []float32, color, affine, []*underlay) {}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := f.Print(10, 20, 1, text); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestWrapLinesKeepsNoBreakSpaces(t *testing.T) {
+	f := newTestFont(t, goregular.TTF, 20)
+
+	lines := f.WrapLines(1, f.Width(1, "100 km"), "go 100 km now")
+	want := []string{"go", "100 km", "now"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("wrapped to %q, want %q", lines, want)
+	}
+}
+
+func TestWrapLinesKeepsSeparators(t *testing.T) {
+	f := newTestFont(t, goregular.TTF, 20)
+
+	text := "  a\tb   c\nd  e"
+	if lines := f.WrapLines(1, 1000, text); !reflect.DeepEqual(lines, []string{"  a\tb   c", "d  e"}) {
+		t.Errorf("wrapped %q to %q, want the lines unchanged", text, lines)
+	}
+
+	// spaces are dropped only where a line is broken
+	lines := f.WrapLines(1, f.Width(1, "  a\tb"), text)
+	want := []string{"  a\tb", "c", "d  e"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("wrapped %q to %q, want %q", text, lines, want)
+	}
+}
+
+func TestBoundingBoxHeightIsTextHeight(t *testing.T) {
+	f := newTestFont(t, goregular.TTF, 20)
+	f.SetLineSpacing(2)
+
+	for _, text := range []string{"", "one line", "two\nlines", "three\nlines\nhere"} {
+		_, h := f.BoundingBox(1, "%s", text)
+		if want := f.TextHeight(1, "%s", text); h != want {
+			t.Errorf("BoundingBox(%q) height %v, TextHeight %v", text, h, want)
+		}
+	}
+	if _, h := f.BoundingBox(1, "one line"); h != f.Height(1) {
+		t.Errorf("single line height %v, want the line height %v", h, f.Height(1))
+	}
+}
+
+func TestFixedAdvanceWidthWithItalic(t *testing.T) {
+	f := newTestFont(t, goregular.TTF, 20)
+	f.SetFixedAdvance(10)
+	f.SetFakeItalic(0.2)
+
+	for _, scale := range []float32{1, 2} {
+		if got, want := f.Width(scale, "abc"), 3*10*scale; got != want {
+			t.Errorf("scale %v: Width = %v, want %v", scale, got, want)
+		}
+	}
+}
+
+func TestSetScaleRejectsNonPositive(t *testing.T) {
+	f := newTestFont(t, goregular.TTF, 20)
+	height := f.Height(1)
+
+	for _, scale := range []int32{0, -12} {
+		if err := f.SetScale(scale); err == nil {
+			t.Errorf("SetScale(%d) succeeded", scale)
+		}
+	}
+	if f.scale != 20 || f.Height(1) != height {
+		t.Errorf("scale %d and height %v after rejected scales, want 20 and %v", f.scale, f.Height(1), height)
+	}
+}
+
+func TestDistanceFieldFollowsEdgesBetweenPixels(t *testing.T) {
+	// a half plane ending 10.125 pixels in, between two pixels of the field, rasterized like sdfCoverage
+	k, spread := sdfSupersample, sdfSpread
+	coverage := image.NewAlpha(image.Rect(0, 0, 20*k, 4*k))
+	for y := 0; y < 4*k; y++ {
+		for x := 0; x < 41; x++ {
+			coverage.Pix[y*coverage.Stride+x] = 255
+		}
+	}
+
+	field := distanceField(coverage, spread, k)
+	if b := field.Bounds(); b.Dx() != 20 || b.Dy() != 4 {
+		t.Fatalf("field is %vx%v, want 20x4", b.Dx(), b.Dy())
+	}
+	for x := 6; x < 14; x++ {
+		// signed distance from the middle of the texel to the edge
+		want := 0.5 + (10.125-(float64(x)+0.5))/float64(2*spread)
+		got := float64(field.AlphaAt(x, 2).A) / 255
+		if math.Abs(got-want) > 1.0/255 {
+			t.Errorf("texel %d is %.3f, want %.3f", x, got, want)
+		}
+	}
+}
+
+func TestDistanceFieldOfGlyph(t *testing.T) {
+	f := newTestFont(t, goregular.TTF, 20)
+	face, err := f.newFaceAt(float64(f.scale*sdfSupersample), font.HintingNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	char, _ := f.glyphMetrics('I')
+	minX, minY := char.bearingH, char.bearingV-char.height
+	field := distanceField(sdfCoverage(face, 'I', minX, minY, char.width, char.height), sdfSpread, sdfSupersample)
+	if b := field.Bounds(); b.Dx() != char.width+2*sdfSpread || b.Dy() != char.height+2*sdfSpread {
+		t.Fatalf("field is %vx%v, want the %vx%v glyph padded by %v", b.Dx(), b.Dy(), char.width, char.height, sdfSpread)
+	}
+
+	// the middle of the stem is inside, the corners of the padding far outside
+	middle := field.AlphaAt(field.Bounds().Dx()/2, field.Bounds().Dy()/2).A
+	if middle <= 128 {
+		t.Errorf("middle of the stem is %d, want inside", middle)
+	}
+	if corner := field.AlphaAt(0, 0).A; corner > 8 {
+		t.Errorf("corner is %d, want about 0", corner)
+	}
+}
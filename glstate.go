@@ -0,0 +1,73 @@
+package glfont
+
+import "github.com/go-gl/gl/all-core/gl"
+
+// glState is the OpenGL state drawing text changes, saved so it can be handed back to the application.
+type glState struct {
+	blend         bool
+	blendSrcRGB   int32
+	blendDstRGB   int32
+	blendSrcAlpha int32
+	blendDstAlpha int32
+	program       int32
+	activeTexture int32
+	unit          uint32 // texture unit text samples the atlas on
+	texture       int32  // 2D texture bound to that unit
+	vao           int32
+	arrayBuffer   int32
+}
+
+// save reads the state drawing text on texture unit unit changes.
+// Fonts keep the state in a field, so saving it on every draw allocates nothing.
+func (s *glState) save(unit uint32) {
+	*s = glState{unit: unit}
+	s.blend = gl.IsEnabled(gl.BLEND)
+	gl.GetIntegerv(gl.BLEND_SRC_RGB, &s.blendSrcRGB)
+	gl.GetIntegerv(gl.BLEND_DST_RGB, &s.blendDstRGB)
+	gl.GetIntegerv(gl.BLEND_SRC_ALPHA, &s.blendSrcAlpha)
+	gl.GetIntegerv(gl.BLEND_DST_ALPHA, &s.blendDstAlpha)
+	gl.GetIntegerv(gl.CURRENT_PROGRAM, &s.program)
+	gl.GetIntegerv(gl.ACTIVE_TEXTURE, &s.activeTexture)
+	gl.GetIntegerv(gl.VERTEX_ARRAY_BINDING, &s.vao)
+	gl.GetIntegerv(gl.ARRAY_BUFFER_BINDING, &s.arrayBuffer)
+
+	gl.ActiveTexture(gl.TEXTURE0 + unit)
+	gl.GetIntegerv(gl.TEXTURE_BINDING_2D, &s.texture)
+	gl.ActiveTexture(uint32(s.activeTexture))
+}
+
+// restore sets the saved state again.
+func (s *glState) restore() {
+	if s.blend {
+		gl.Enable(gl.BLEND)
+	} else {
+		gl.Disable(gl.BLEND)
+	}
+	gl.BlendFuncSeparate(uint32(s.blendSrcRGB), uint32(s.blendDstRGB), uint32(s.blendSrcAlpha), uint32(s.blendDstAlpha))
+	gl.UseProgram(uint32(s.program))
+	gl.BindVertexArray(uint32(s.vao))
+	gl.BindBuffer(gl.ARRAY_BUFFER, uint32(s.arrayBuffer))
+
+	gl.ActiveTexture(gl.TEXTURE0 + s.unit)
+	gl.BindTexture(gl.TEXTURE_2D, uint32(s.texture))
+	gl.ActiveTexture(uint32(s.activeTexture))
+}
+
+// textureState is the OpenGL state updating a glyph atlas changes, saved like glState
+// so the application finds its texture binding and unpack alignment as it left them.
+type textureState struct {
+	texture         int32 // 2D texture bound to the active unit
+	unpackAlignment int32
+}
+
+// save reads the state updating an atlas changes.
+func (s *textureState) save() {
+	gl.GetIntegerv(gl.TEXTURE_BINDING_2D, &s.texture)
+	gl.GetIntegerv(gl.UNPACK_ALIGNMENT, &s.unpackAlignment)
+}
+
+// restore sets the saved state again.
+func (s *textureState) restore() {
+	gl.BindTexture(gl.TEXTURE_2D, uint32(s.texture))
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, s.unpackAlignment)
+}
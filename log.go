@@ -0,0 +1,14 @@
+package glfont
+
+// logf receives the diagnostics of the package, set by SetLogger.
+var logf = func(format string, args ...interface{}) {}
+
+// SetLogger routes the diagnostics of the package, like runes without a glyph and glyphs
+// that fail to load, to fn, e.g. log.Printf. They are discarded by default, nil discards them again.
+// Set it before fonts are used from several goroutines.
+func SetLogger(fn func(format string, args ...interface{})) {
+	if fn == nil {
+		fn = func(format string, args ...interface{}) {}
+	}
+	logf = fn
+}
@@ -0,0 +1,83 @@
+package glfont
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/go-gl/gl/all-core/gl"
+)
+
+// RenderToTexture draws text once into a new RGBA texture sized to its bounding box,
+// for static labels that are drawn many times. The texture holds premultiplied alpha and is upright
+// in OpenGL convention, its first row is the bottom of the text. The caller owns the texture and
+// deletes it with gl.DeleteTextures. The framebuffer, viewport and clear color of the caller are restored.
+func (f *Font) RenderToTexture(scale float32, text string) (textureID uint32, w, h int, err error) {
+	bw, bh := f.BoundingBox(scale, "%s", text)
+	w, h = int(math.Ceil(float64(bw))), int(math.Ceil(float64(bh)))
+	if w == 0 || h == 0 {
+		return 0, 0, 0, fmt.Errorf("text %q has no size to render", text)
+	}
+
+	gl.GenTextures(1, &textureID)
+	gl.BindTexture(gl.TEXTURE_2D, textureID)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA8, int32(w), int32(h), 0, gl.RGBA, gl.UNSIGNED_BYTE, nil)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+
+	// remember the target of the caller
+	var framebuffer int32
+	var viewport [4]int32
+	var clearColor [4]float32
+	gl.GetIntegerv(gl.FRAMEBUFFER_BINDING, &framebuffer)
+	gl.GetIntegerv(gl.VIEWPORT, &viewport[0])
+	gl.GetFloatv(gl.COLOR_CLEAR_VALUE, &clearColor[0])
+
+	var fbo uint32
+	gl.GenFramebuffers(1, &fbo)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, fbo)
+	defer func() {
+		gl.BindFramebuffer(gl.FRAMEBUFFER, uint32(framebuffer))
+		gl.Viewport(viewport[0], viewport[1], viewport[2], viewport[3])
+		gl.ClearColor(clearColor[0], clearColor[1], clearColor[2], clearColor[3])
+		gl.DeleteFramebuffers(1, &fbo)
+	}()
+
+	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, textureID, 0)
+	if status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER); status != gl.FRAMEBUFFER_COMPLETE {
+		gl.DeleteTextures(1, &textureID)
+		return 0, 0, 0, fmt.Errorf("text framebuffer incomplete: 0x%x", status)
+	}
+
+	gl.Viewport(0, 0, int32(w), int32(h))
+	gl.ClearColor(0, 0, 0, 0)
+	gl.Clear(gl.COLOR_BUFFER_BIT)
+
+	// map the pixels of the texture to clip space, y pointing down like the window
+	projection := f.projection
+	f.SetProjection([16]float32{
+		2 / float32(w), 0, 0, 0,
+		0, -2 / float32(h), 0, 0,
+		0, 0, 1, 0,
+		-1, 1, 0, 1,
+	})
+	defer func() { f.projection = projection }()
+
+	// start where the text fills the box from its top left corner
+	x, y := float32(0), f.Metrics().Ascent*scale
+	switch f.direction {
+	case RightToLeft:
+		x = float32(w)
+	case TopToBottom:
+		x, y = float32(w)-f.lineAdvance()*scale, 0
+	}
+
+	_, _, err = f.Print(x, y, scale, text)
+	if err != nil {
+		gl.DeleteTextures(1, &textureID)
+		return 0, 0, 0, err
+	}
+	return textureID, w, h, nil
+}
@@ -0,0 +1,95 @@
+package glfont
+
+import (
+	"image"
+	"image/draw"
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Padding in pixels around signed distance field glyphs, the distance at which the field
+// reaches fully inside or fully outside.
+const sdfSpread = 6
+
+// Signed distance field glyphs are rasterized this many times larger than they are stored,
+// so the field follows the outline between pixels and stays smooth when magnified.
+const sdfSupersample = 4
+
+// sdfCoverage rasterizes the glyph of r with face, sdfSupersample times larger than the font's face, for distanceField.
+// The image covers the glyph's w by h pixel bounds at minX, minY at the font's size and sdfSpread pixels around them,
+// every pixel as sdfSupersample by sdfSupersample texels. The glyph is moved half a texel right and down,
+// so the texel at the middle of each pixel is centered on the pixel.
+func sdfCoverage(face font.Face, r rune, minX, minY, w, h int) *image.Alpha {
+	k := sdfSupersample
+	coverage := image.NewAlpha(image.Rect(0, 0, (w+2*sdfSpread)*k, (h+2*sdfSpread)*k))
+
+	// the baseline dot of the padded glyph, 32 is half a texel in 26.6 fixed point
+	dot := fixed.Point26_6{
+		X: fixed.I((sdfSpread-minX)*k) + 32,
+		Y: fixed.I((sdfSpread-minY)*k) + 32,
+	}
+	dr, mask, maskp, _, ok := face.Glyph(dot, r)
+	if ok {
+		draw.DrawMask(coverage, dr, image.Opaque, image.Point{}, mask, maskp, draw.Over)
+	}
+	return coverage
+}
+
+// distanceField converts glyph coverage, rasterized supersample times larger like sdfCoverage does,
+// into a signed distance field with a texel for every supersample by supersample texels of coverage.
+// Texels on the outline store 0.5, texels inside the glyph more and outside less,
+// reaching 1 and 0 spread texels of the field away from the outline.
+func distanceField(coverage *image.Alpha, spread, supersample int) *image.Alpha {
+	b := coverage.Bounds()
+	cw, ch := b.Dx(), b.Dy()
+
+	// threshold the coverage once, at its resolution the outline falls between its texels
+	inside := make([]bool, cw*ch)
+	for y := 0; y < ch; y++ {
+		for x := 0; x < cw; x++ {
+			inside[y*cw+x] = coverage.AlphaAt(b.Min.X+x, b.Min.Y+y).A >= 128
+		}
+	}
+
+	// distances are searched in coverage texels
+	reach := spread * supersample
+	w, h := cw/supersample, ch/supersample
+	field := image.NewAlpha(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// the coverage texel centered on the field texel
+			cx, cy := x*supersample+supersample/2, y*supersample+supersample/2
+			in := inside[cy*cw+cx]
+
+			// nearest texel on the other side of the outline within reach
+			nearest := reach * reach
+			for dy := -reach; dy <= reach; dy++ {
+				ny := cy + dy
+				if ny < 0 || ny >= ch || dy*dy >= nearest {
+					continue
+				}
+				for dx := -reach; dx <= reach; dx++ {
+					nx := cx + dx
+					if nx < 0 || nx >= cw {
+						continue
+					}
+					if inside[ny*cw+nx] != in && dx*dx+dy*dy < nearest {
+						nearest = dx*dx + dy*dy
+					}
+				}
+			}
+
+			// the outline runs halfway between the two texels, the field is in its own texels
+			dist := (math.Sqrt(float64(nearest)) - 0.5) / float64(supersample)
+			if !in {
+				dist = -dist
+			}
+
+			v := 0.5 + dist/float64(2*spread)
+			field.Pix[y*field.Stride+x] = uint8(math.Max(0, math.Min(1, v)) * 255)
+		}
+	}
+	return field
+}
@@ -5,8 +5,68 @@ import (
 
 	"fmt"
 	"strings"
+	"sync"
 )
 
+//programs counts the fonts using each program, a program used by a single font has no entry,
+//programs passed to LoadTrueTypeFont also count the caller owning them
+var programs struct {
+	sync.Mutex
+	defaultID uint32         //program built from the default shaders, shared by all fonts loaded with LoadFont and LoadFontBytes
+	refs      map[uint32]int //number of fonts using the program
+}
+
+//acquireDefaultProgram returns the default program, compiling it on first use
+func acquireDefaultProgram() (uint32, error) {
+	programs.Lock()
+	defer programs.Unlock()
+
+	if programs.defaultID == 0 {
+		program, err := newProgram(vertexFontShader, fragmentFontShader)
+		if err != nil {
+			return 0, err
+		}
+		programs.defaultID = program
+	}
+
+	if programs.refs == nil {
+		programs.refs = make(map[uint32]int)
+	}
+	programs.refs[programs.defaultID]++
+	return programs.defaultID, nil
+}
+
+//retainProgram adds a font using a program, like a clone sharing the program of its font
+func retainProgram(program uint32) {
+	programs.Lock()
+	defer programs.Unlock()
+
+	if programs.refs == nil {
+		programs.refs = make(map[uint32]int)
+	}
+	if _, ok := programs.refs[program]; !ok {
+		programs.refs[program] = 1
+	}
+	programs.refs[program]++
+}
+
+//releaseProgram deletes a font's program once no font uses it anymore
+func releaseProgram(program uint32) {
+	programs.Lock()
+	defer programs.Unlock()
+
+	if refs := programs.refs[program]; refs > 1 {
+		programs.refs[program] = refs - 1
+		return
+	}
+
+	gl.DeleteProgram(program)
+	delete(programs.refs, program)
+	if program == programs.defaultID {
+		programs.defaultID = 0
+	}
+}
+
 //newProgram links the frag and vertex shader programs
 func newProgram(vertexShaderSource, fragmentShaderSource string) (uint32, error) {
 	vertexShader, err := compileShader(vertexShaderSource, gl.VERTEX_SHADER)
@@ -69,15 +129,58 @@ func compileShader(source string, shaderType uint32) (uint32, error) {
 
 var fragmentFontShader = `#version 150 core
 in vec2 fragTexCoord;
+in vec2 fragPosition;
 out vec4 outputColor;
 
 uniform sampler2D tex;
 uniform vec4 textColor;
+uniform float gamma;
+uniform bool sdf;
+uniform bool colored;
+uniform bool srgb;
+uniform bool clip;
+uniform vec4 clipRect;
 
 void main()
 {    
-    vec4 sampled = vec4(1.0, 1.0, 1.0, texture(tex, fragTexCoord).r);
-    outputColor = textColor * sampled;
+    // drop fragments outside the clip rectangle, x, y, width and height in pixels
+    if (clip && (fragPosition.x < clipRect.x || fragPosition.y < clipRect.y ||
+        fragPosition.x >= clipRect.x + clipRect.z || fragPosition.y >= clipRect.y + clipRect.w)) {
+        discard;
+    }
+
+    // color glyphs are premultiplied RGBA bitmaps, faded by the text alpha but not tinted
+    if (colored) {
+        vec4 color = texture(tex, fragTexCoord);
+        if (srgb && color.a > 0.0) {
+            color.rgb = pow(color.rgb / color.a, vec3(2.2)) * color.a;
+        }
+        outputColor = color * textColor.a;
+        return;
+    }
+
+    // glyph coverage or distance field, stored in the red channel
+    float value = texture(tex, fragTexCoord).r;
+
+    // distance fields are antialiased over about a screen pixel around the outline at 0.5
+    if (sdf) {
+        float width = fwidth(value) * 0.5;
+        value = smoothstep(0.5 - width, 0.5 + width, value);
+    }
+    float coverage = pow(value, 1.0 / gamma);
+
+    // sRGB framebuffers blend in linear light, linearize the color and correct the coverage
+    // so dark text on light backgrounds and light text on dark ones keep their weight
+    vec3 rgb = textColor.rgb;
+    if (srgb) {
+        rgb = pow(rgb, vec3(2.2));
+        float luminance = dot(rgb, vec3(0.2126, 0.7152, 0.0722));
+        coverage = mix(1.0 - pow(1.0 - coverage, 2.2), pow(coverage, 2.2), luminance);
+    }
+
+    // output premultiplied alpha
+    float alpha = textColor.a * coverage;
+    outputColor = vec4(rgb * alpha, alpha);
 }` + "\x00"
 
 var vertexFontShader = `#version 150 core
@@ -91,12 +194,31 @@ in vec2 vertTexCoord;
 //window res
 uniform vec2 resolution;
 
+//moves, rotates the text in pixels
+uniform mat3 transform;
+
+//replaces the window res mapping when set
+uniform mat4 projection;
+uniform bool useProjection;
+
 //pass to frag
 out vec2 fragTexCoord;
+out vec2 fragPosition;
 
 void main() {
+   // place the text
+   vec2 position = (transform * vec3(vert, 1.0)).xy;
+
+   fragTexCoord = vertTexCoord;
+   fragPosition = position;
+
+   if (useProjection) {
+      gl_Position = projection * vec4(position, 0, 1);
+      return;
+   }
+
    // convert the rectangle from pixels to 0.0 to 1.0
-   vec2 zeroToOne = vert / resolution;
+   vec2 zeroToOne = position / resolution;
 
    // convert from 0->1 to 0->2
    vec2 zeroToTwo = zeroToOne * 2.0;
@@ -104,7 +226,5 @@ void main() {
    // convert from 0->2 to -1->+1 (clipspace)
    vec2 clipSpace = zeroToTwo - 1.0;
 
-   fragTexCoord = vertTexCoord;
-
    gl_Position = vec4(clipSpace * vec2(1, -1), 0, 1);
 }` + "\x00"
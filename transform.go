@@ -0,0 +1,78 @@
+package glfont
+
+import "math"
+
+// affine is a 2D transform of pixel coordinates, stored as a column major 3x3 matrix
+// for the transform uniform of the vertex shader.
+type affine [9]float32
+
+// identity leaves coordinates unchanged.
+var identity = affine{
+	1, 0, 0,
+	0, 1, 0,
+	0, 0, 1,
+}
+
+// rotation rotates by radians around the origin and then moves the origin to (x, y).
+// With y pointing down the screen a positive angle turns clockwise.
+func rotation(x, y, radians float32) affine {
+	sin, cos := math.Sincos(float64(radians))
+	s, c := float32(sin), float32(cos)
+	return affine{
+		c, s, 0,
+		-s, c, 0,
+		x, y, 1,
+	}
+}
+
+// translate moves the result of the transform by (dx, dy).
+func (a affine) translate(dx, dy float32) affine {
+	a[6] += dx
+	a[7] += dy
+	return a
+}
+
+// stretch scales by sx horizontally and sy vertically around the origin and then moves the origin to (x, y).
+func stretch(x, y, sx, sy float32) affine {
+	return affine{
+		sx, 0, 0,
+		0, sy, 0,
+		x, y, 1,
+	}
+}
+
+// bendQuads moves each quad of vertices, laid out along a baseline at y 0, onto the circle of radius around (cx, cy),
+// the middle of its baseline on the circle and its baseline tangent to it. Pen position x is at the angle
+// startAngle + x/radius in radians, clockwise from the positive x axis. With a positive radius the quads run clockwise
+// with their tops outwards, with a negative radius counterclockwise with their tops towards the center.
+func bendQuads(vertices []float32, cx, cy, radius, startAngle float32) {
+	sign := float32(1)
+	if radius < 0 {
+		sign = -1
+	}
+
+	for q := 0; q+floatsPerGlyph <= len(vertices); q += floatsPerGlyph {
+		quad := vertices[q : q+floatsPerGlyph]
+
+		// the quad turns around the middle of its baseline
+		minX, maxX := quad[0], quad[0]
+		for v := floatsPerVertex; v < len(quad); v += floatsPerVertex {
+			minX = float32(math.Min(float64(minX), float64(quad[v])))
+			maxX = float32(math.Max(float64(maxX), float64(quad[v])))
+		}
+		mid := (minX + maxX) / 2
+
+		sin, cos := math.Sincos(float64(startAngle + mid/radius))
+		s, c := float32(sin), float32(cos)
+		// point on the circle, direction of the baseline and direction of the glyph tops
+		px, py := cx+sign*radius*c, cy+sign*radius*s
+		tx, ty := -s*sign, c*sign
+		ux, uy := c*sign, s*sign
+
+		for v := 0; v < len(quad); v += floatsPerVertex {
+			dx, y := quad[v]-mid, quad[v+1]
+			quad[v] = px + dx*tx - y*ux
+			quad[v+1] = py + dx*ty - y*uy
+		}
+	}
+}
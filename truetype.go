@@ -3,176 +3,810 @@ package glfont
 import (
 	"fmt"
 	"github.com/go-gl/gl/all-core/gl"
-	"github.com/golang/freetype"
 	"github.com/golang/freetype/truetype"
 	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
 	"golang.org/x/image/math/fixed"
 	"image"
 	"image/draw"
 	"io"
 	"io/ioutil"
+	"math"
+	"sort"
+	"sync"
+	"unicode"
 )
 
 // A Font allows rendering of text to an OpenGL context.
+// The glyph cache is guarded by a mutex and measuring text makes no OpenGL calls,
+// so text can be measured on any goroutine. Drawing and loading glyphs upload to
+// the atlas texture and must happen on the thread owning the OpenGL context.
 type Font struct {
-	fontChar map[rune]*character
-	ttf      *truetype.Font
-	scale    int32
-	vao      uint32
-	vbo      uint32
-	program  uint32
-	texture  uint32 // Holds the glyph texture id.
-	color    color
+	*glyphCache      // Shared with clones.
+	*buffers         // Shared with fonts set up by ShareBuffers.
+	program          uint32
+	color            color
+	kerning          bool             // Adjust the space between glyph pairs.
+	direction        Direction        // Direction in which strings are rendered.
+	lineSpacing      float32          // Multiplier of the line height between lines.
+	letterSpacing    float32          // Extra pixels between glyphs.
+	gamma            float32          // Gamma applied to the glyph coverage.
+	underline        bool             // Draw a line below the text.
+	strikethrough    bool             // Draw a line through the text.
+	bold             float32          // Pixels glyphs are thickened by for fake bold.
+	italic           float32          // Horizontal shear of glyphs for fake italic.
+	shadow           *underlay        // Drawn below the text, nil if disabled.
+	outline          *underlay        // Drawn around the text, nil if disabled.
+	tabWidth         int              // Distance between tab stops in spaces.
+	missingGlyph     func(r rune)     // Called for runes the font has no glyph for.
+	projection       *[16]float32     // Maps pixels to clip space instead of the resolution, nil if unset.
+	fallbacks        []*Font          // Fonts drawing the runes this font has no glyph for.
+	clip             *[4]float32      // Rectangle text is clipped to, nil if unset.
+	background       *color           // Box drawn behind the text, nil if disabled.
+	pixelSnap        bool             // Round glyph positions to whole pixels.
+	fixedAdvance     float32          // Width of the cell each glyph takes in pixels, 0 for proportional spacing.
+	autoResolution   bool             // Map text with the viewport size instead of the resolution uniform.
+	textureUnit      uint32           // Texture unit the atlas is bound to while drawing.
+	tabStops         []float32        // Offsets of tab stops from the start of the line in pixels, in increasing order.
+	batchSize        int              // Number of glyphs loaded together around a missing rune.
+	srgb             bool             // Draw for an sRGB framebuffer blending in linear light.
+	inkAlign         bool             // Move the first glyph of each line so its ink starts at the pen.
+	advanceOverrides map[rune]float32 // Advances in pixels replacing those of the font, by rune.
+	runes            []rune           // Reused by Print to decode strings.
+	vertices         []float32        // Reused by Print to collect quads.
+	pen              pen              // Reused by Print to lay out strings.
+	saved            glState          // State of the application while text is drawn.
+	underlays        [2]*underlay     // Shadow and outline, reused by draw.
+	matrix           affine           // Transform uniform, kept in the font as OpenGL reads it through a pointer.
+}
+
+// glyphCache holds the parsed font and its rasterized glyphs, shared by a font and its clones.
+type glyphCache struct {
+	mu         sync.RWMutex // Guards fontChar, the atlas, the face and refs.
+	fontChar   map[rune]*character
+	ttf        *truetype.Font // Nil for OpenType fonts with CFF outlines.
+	sfnt       *sfnt.Font     // Same font data, used for metrics truetype does not expose.
+	face       font.Face      // Measures and rasterizes glyphs of either of the above.
+	metrics    font.Metrics   // Vertical metrics at the rasterized size.
+	scale      int32
+	atlas      *atlas        // Holds the glyph texture.
+	vertical   bool          // The font has vertical metrics (vmtx table).
+	sdf        bool          // Glyphs are stored as signed distance fields.
+	dpi        float64       // Resolution glyphs are rasterized at, at 72 a point is a pixel.
+	hinting    font.Hinting  // Grid fitting of glyph outlines.
+	bitmaps    *colorBitmaps // Color glyph bitmaps, like emoji, nil if the font has none.
+	colorAtlas *atlas        // Holds the color glyph bitmaps, nil until one is loaded.
+	padding    int           // Transparent pixels around each glyph in the atlas.
+	baked      *color        // Color glyphs are rasterized in, nil to color them while drawing.
+	aliased    bool          // Glyph coverage is thresholded to hard edges.
+	refs       int           // Number of fonts sharing the cache.
+	maxGlyphs  int           // Glyphs kept before the least recently used are evicted, 0 for no limit.
+
+	usedMu sync.Mutex      // Guards used and clock, lookups only hold mu for reading.
+	used   map[rune]uint64 // Clock of the last lookup of each glyph, while maxGlyphs is set.
+	clock  uint64
 }
 
 type character struct {
-	textureID uint32 // ID handle of the glyph texture
-	width     int    //glyph width
-	height    int    //glyph height
-	advance   int    //glyph advance
-	bearingH  int    //glyph bearing horizontal
-	bearingV  int    //glyph bearing vertical
+	u0       float32 //left texture coordinate in the atlas
+	v0       float32 //top texture coordinate in the atlas
+	u1       float32 //right texture coordinate in the atlas
+	v1       float32 //bottom texture coordinate in the atlas
+	width    int     //glyph width
+	height   int     //glyph height
+	advance  int     //glyph advance
+	vadvance int     //glyph vertical advance, for TopToBottom text
+	bearingH int     //glyph bearing horizontal
+	bearingV int     //glyph bearing vertical
+	colored  bool    //glyph is a color bitmap in the color atlas
+	missing  bool    //the font has no glyph for the rune, cached so it is not loaded again
 }
 
-//GenerateGlyphs builds a set of textures based on a ttf files gylphs
+//GenerateGlyphs packs a set of ttf file gylphs into the font's atlas texture, glyphs already packed are skipped
 func (f *Font) GenerateGlyphs(low, high rune) error {
-	//create a freetype context for drawing
-	c := freetype.NewContext()
-	c.SetDPI(72)
-	c.SetFont(f.ttf)
-	c.SetFontSize(float64(f.scale))
-	c.SetHinting(font.HintingFull)
-
-	//create new face to measure glyph dimensions
-	ttfFace := truetype.NewFace(f.ttf, &truetype.Options{
-		Size:    float64(f.scale),
-		DPI:     72,
-		Hinting: font.HintingFull,
-	})
+	//only valid code points have glyphs, stopping at unicode.MaxRune also keeps ch++ from overflowing
+	if low < 0 {
+		low = 0
+	}
+	if high > unicode.MaxRune {
+		high = unicode.MaxRune
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	//keep the texture and unpack alignment the application has set
+	var saved textureState
+	saved.save()
+	defer saved.restore()
+	gl.BindTexture(gl.TEXTURE_2D, f.atlas.texture)
+
+	//distance fields are computed from unhinted glyphs rasterized sdfSupersample times larger
+	var sdfFace font.Face
+	if f.sdf {
+		var err error
+		sdfFace, err = f.newFaceAt(float64(f.scale*sdfSupersample), font.HintingNone)
+		if err != nil {
+			return err
+		}
+	}
 
 	//make each gylph
 	for ch := low; ch <= high; ch++ {
-		char := new(character)
+		//another goroutine may have loaded the same batch
+		if _, ok := f.fontChar[ch]; ok {
+			continue
+		}
 
-		gBnd, gAdv, ok := ttfFace.GlyphBounds(ch)
+		//runes the font lacks would get its .notdef glyph, they are remembered as missing instead
+		if !f.hasGlyph(ch) {
+			f.fontChar[ch] = &character{missing: true}
+			continue
+		}
+
+		//glyphs with an embedded color bitmap, like emoji, are drawn from it
+		char, colored, err := f.colorGlyph(ch)
+		if err != nil {
+			return err
+		}
+		if colored {
+			f.fontChar[ch] = char
+			continue
+		}
+
+		char, ok := f.glyphMetrics(ch)
 		if ok != true {
 			return fmt.Errorf("ttf face glyphBounds error")
 		}
 
-		gh := int32((gBnd.Max.Y - gBnd.Min.Y) >> 6)
-		gw := int32((gBnd.Max.X - gBnd.Min.X) >> 6)
+		//glyphs without dimensions, like spaces and zero-width characters, only move the pen,
+		//they take no room in the atlas and are not drawn
+		if char.width == 0 {
+			f.fontChar[ch] = char
+			continue
+		}
+		gw, gh := char.width, char.height
+		minX, minY := char.bearingH, char.bearingV-gh
+
+		//create image to draw the glyph coverage, it starts out transparent and only holds alpha,
+		//the color is applied premultiplied in the shader so edges get no dark fringes
+		fg := image.Opaque
+		rect := image.Rect(0, 0, gw, gh)
+		coverage := image.NewAlpha(rect)
+
+		//set the glyph dot, the baseline is row -minY of the image
+		dot := fixed.P(-minX, -minY)
 
-		//if gylph has no dimensions set to a max value
-		if gw == 0 || gh == 0 {
-			gBnd = f.ttf.Bounds(fixed.Int26_6(f.scale))
-			gw = int32((gBnd.Max.X - gBnd.Min.X) >> 6)
-			gh = int32((gBnd.Max.Y - gBnd.Min.Y) >> 6)
+		// Draw the glyph from mask to image
+		dr, mask, maskp, _, ok := f.face.Glyph(dot, ch)
+		if ok {
+			draw.DrawMask(coverage, dr, fg, image.Point{}, mask, maskp, draw.Over)
+		}
 
-			//above can sometimes yield 0 for font smaller than 48pt, 1 is minimum
-			if gw == 0 || gh == 0 {
-				gw = 1
-				gh = 1
+		//aliased glyphs are fully covered or empty
+		if f.aliased {
+			for i, a := range coverage.Pix {
+				if a >= 128 {
+					coverage.Pix[i] = 255
+				} else {
+					coverage.Pix[i] = 0
+				}
 			}
 		}
 
-		//The glyph's ascent and descent equal -bounds.Min.Y and +bounds.Max.Y.
-		gAscent := int(-gBnd.Min.Y) >> 6
-		gdescent := int(gBnd.Max.Y) >> 6
-
-		//set w,h and adv, bearing V and bearing H in char
-		char.width = int(gw)
-		char.height = int(gh)
-		char.advance = int(gAdv)
-		char.bearingV = gdescent
-		char.bearingH = (int(gBnd.Min.X) >> 6)
-
-		//create image to draw glyph
-		fg, bg := image.White, image.Black
-		rect := image.Rect(0, 0, int(gw), int(gh))
-		rgba := image.NewRGBA(rect)
-		draw.Draw(rgba, rgba.Bounds(), bg, image.ZP, draw.Src)
-
-		//set the glyph dot
-		px := 0 - (int(gBnd.Min.X) >> 6)
-		py := (gAscent)
-		pt := freetype.Pt(px, py)
-
-		// Draw the text from mask to image
-		c.SetClip(rgba.Bounds())
-		c.SetDst(rgba)
-		c.SetSrc(fg)
-		_, err := c.DrawString(string(ch), pt)
-		if err != nil {
-			return err
+		//baked glyphs are stored in their color in the color atlas
+		if f.baked != nil {
+			err := f.packColor(char, bake(coverage, *f.baked))
+			if err != nil {
+				return err
+			}
+			f.fontChar[ch] = char
+			continue
 		}
 
-		// Generate texture
-		var texture uint32
-		gl.GenTextures(1, &texture)
-		gl.BindTexture(gl.TEXTURE_2D, texture)
-		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
-		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
-		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
-		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
-		gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, int32(rgba.Rect.Dx()), int32(rgba.Rect.Dy()), 0,
-			gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(rgba.Pix))
+		//distance fields need room around the outline, they are computed from the glyph rasterized larger
+		if f.sdf {
+			coverage = distanceField(sdfCoverage(sdfFace, ch, minX, minY, gw, gh), sdfSpread, sdfSupersample)
+			char.width += 2 * sdfSpread
+			char.height += 2 * sdfSpread
+			char.bearingH -= sdfSpread
+			char.bearingV += sdfSpread
+		}
 
-		char.textureID = texture
+		// Pack glyph into the atlas
+		_, oldHeight := f.atlas.size()
+		ax, ay, err := f.atlas.add(coverage)
+		if err != nil {
+			return err
+		}
+		f.place(char, f.atlas, ax, ay, oldHeight)
 
 		//add char to fontChar list
 		f.fontChar[ch] = char
 	}
 
-	gl.BindTexture(gl.TEXTURE_2D, 0)
+	f.atlas.updateMipmaps()
+	return nil
+}
+
+//glyphMetrics returns the character of the outline glyph of r with its advances and the whole pixel bounds
+//containing it, without rasterizing it. It is false if the face has no bounds for r.
+func (f *Font) glyphMetrics(r rune) (*character, bool) {
+	gBnd, gAdv, ok := f.face.GlyphBounds(r)
+	if ok != true {
+		return nil, false
+	}
+
+	char := new(character)
+	char.advance = int(gAdv)
+	char.vadvance = f.verticalAdvance(r)
+
+	//whole pixel bounds containing the glyph, relative to the dot on the baseline
+	minX, minY := gBnd.Min.X.Floor(), gBnd.Min.Y.Floor()
+	maxX, maxY := gBnd.Max.X.Ceil(), gBnd.Max.Y.Ceil()
+
+	//glyphs without dimensions, like spaces and zero-width characters, keep no bounds
+	if minX == maxX || minY == maxY {
+		return char, true
+	}
+
+	//set w,h, bearing V and bearing H in char,
+	//height - bearingV is exactly the rows above the baseline so all glyphs share it
+	char.width = maxX - minX
+	char.height = maxY - minY
+	char.bearingV = maxY
+	char.bearingH = minX
+	return char, true
+}
+
+//place sets the texture coordinates of a glyph packed into a at ax, ay.
+//If the atlas grew from oldHeight the glyphs packed into it before move to their new v coordinates.
+func (f *Font) place(char *character, a *atlas, ax, ay, oldHeight int) {
+	aw, ah := a.size()
+	if ah != oldHeight {
+		ratio := float32(oldHeight) / float32(ah)
+		for _, packed := range f.fontChar {
+			if packed.colored == a.rgba {
+				packed.v0 *= ratio
+				packed.v1 *= ratio
+			}
+		}
+	}
+
+	char.u0 = float32(ax) / float32(aw)
+	char.v0 = float32(ay) / float32(ah)
+	char.u1 = float32(ax+char.width) / float32(aw)
+	char.v1 = float32(ay+char.height) / float32(ah)
+}
+
+//clearGlyphs empties the glyph cache and the atlas, it returns the runes that were loaded
+func (f *Font) clearGlyphs() []rune {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	runes := make([]rune, 0, len(f.fontChar))
+	for r := range f.fontChar {
+		runes = append(runes, r)
+	}
+
+	var saved textureState
+	saved.save()
+	old := f.atlas
+	old.release()
+	f.atlas = newAtlas(f.padding)
+	f.atlas.mipmaps = old.mipmaps
+	f.atlas.setFilter(old.min, old.mag)
+	saved.restore()
+	if f.colorAtlas != nil {
+		f.colorAtlas.release()
+		f.colorAtlas = nil
+	}
+	f.fontChar = make(map[rune]*character)
+	return runes
+}
+
+//regenerate generates glyphs for runes again after the cache was cleared
+func (f *Font) regenerate(runes []rune) error {
+	//in order, keeping neighbouring glyphs together in the atlas
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+	for _, r := range runes {
+		err := f.GenerateGlyphs(r, r)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//lookup returns a copy of a packed glyph, safe to use while other goroutines generate glyphs
+func (f *Font) lookup(r rune) (character, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	ch, ok := f.fontChar[r]
+	if !ok || ch.missing {
+		return character{}, false
+	}
+	if f.maxGlyphs > 0 {
+		f.touch(r)
+	}
+	return *ch, true
+}
+
+//cached reports whether r was loaded before, also if the font turned out to have no glyph for it
+func (f *Font) cached(r rune) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	_, ok := f.fontChar[r]
+	return ok
+}
+
+//touch marks the glyph of r as just used
+func (f *Font) touch(r rune) {
+	f.usedMu.Lock()
+	defer f.usedMu.Unlock()
+
+	f.clock++
+	f.used[r] = f.clock
+}
+
+//evict drops the least recently used glyphs once more than maxGlyphs are loaded, down to three quarters of it,
+//and packs the others into a new atlas. Glyphs in quads that were not drawn yet must not be evicted.
+func (f *Font) evict() error {
+	f.mu.RLock()
+	keep := f.maxGlyphs * 3 / 4
+	over := f.maxGlyphs > 0 && len(f.fontChar) > f.maxGlyphs
+	f.mu.RUnlock()
+	if !over {
+		return nil
+	}
+
+	runes := f.clearGlyphs()
+
+	f.usedMu.Lock()
+	sort.Slice(runes, func(i, j int) bool { return f.used[runes[i]] > f.used[runes[j]] })
+	if len(runes) > keep {
+		runes = runes[:keep]
+	}
+	used := make(map[rune]uint64, len(runes))
+	for _, r := range runes {
+		used[r] = f.used[r]
+	}
+	f.used = used
+	f.usedMu.Unlock()
+
+	return f.regenerate(runes)
+}
+
+//loadBatch loads a batch of glyphs for glyph, tests without an OpenGL context replace it
+var loadBatch = (*Font).GenerateGlyphs
+
+//glyph returns the glyph of a rune, missing runes are loaded in aligned batches of the glyph batch size
+func (f *Font) glyph(r rune) (character, bool) {
+	ch, ok := f.lookup(r)
+	if ok {
+		return ch, true
+	}
+	if r < 0 || r > unicode.MaxRune || f.cached(r) {
+		return character{}, false
+	}
+
+	batch := rune(f.batchSize)
+	low := r - (r % batch)
+	if err := loadBatch(f, low, low+batch-1); err != nil {
+		logf("glfont: loading glyphs %U to %U: %v", low, low+batch-1, err)
+	}
+	return f.lookup(r)
+}
+
+//faceAdvances returns the advances of r in 1/64 glyph pixels as GenerateGlyphs stores them, from the cache or the face
+func (f *Font) faceAdvances(r rune) (advance, vadvance int, ok bool) {
+	if ch, ok := f.lookup(r); ok {
+		return ch.advance, ch.vadvance, true
+	}
+
+	if !f.HasGlyph(r) {
+		return 0, 0, false
+	}
+
+	f.mu.Lock()
+	adv, ok := f.face.GlyphAdvance(r)
+	f.mu.Unlock()
+	if !ok {
+		return 0, 0, false
+	}
+	return int(adv), f.verticalAdvance(r), true
+}
+
+//newFace creates the face glyphs are measured and rasterized with, at the font's scale
+func (f *Font) newFace() (font.Face, error) {
+	return f.newFaceAt(float64(f.scale), f.hinting)
+}
+
+//newFaceAt creates a face of the font at another size in points at the font's dpi, with the given hinting
+func (f *Font) newFaceAt(size float64, hinting font.Hinting) (font.Face, error) {
+	if f.ttf != nil {
+		return truetype.NewFace(f.ttf, &truetype.Options{
+			Size:    size,
+			DPI:     f.dpi,
+			Hinting: hinting,
+		}), nil
+	}
+
+	return opentype.NewFace(f.sfnt, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     f.dpi,
+		Hinting: hinting,
+	})
+}
+
+//setRasterizer rasterizes glyphs at a new scale, dpi and hinting, the glyph cache is cleared and refilled as glyphs are drawn.
+//It returns the runes that were cached.
+func (f *Font) setRasterizer(scale int32, dpi float64, hinting font.Hinting) ([]rune, error) {
+	f.mu.Lock()
+	oldScale, oldDPI, oldHinting := f.scale, f.dpi, f.hinting
+	f.scale, f.dpi, f.hinting = scale, dpi, hinting
+	face, err := f.newFace()
+	if err == nil {
+		err = f.loadMetrics()
+	}
+	if err != nil {
+		f.scale, f.dpi, f.hinting = oldScale, oldDPI, oldHinting
+		f.mu.Unlock()
+		return nil, err
+	}
+	f.face = face
+	f.mu.Unlock()
+
+	return f.clearGlyphs(), nil
+}
+
+//pixelSize returns the size glyphs are rasterized at in pixels of the display
+func (f *Font) pixelSize() float64 {
+	return float64(f.scale) * f.dpi / 72
+}
+
+//pixelRatio returns the number of display pixels per logical pixel, glyph sizes are divided by it for layout
+func (f *Font) pixelRatio() float32 {
+	return float32(f.dpi / 72)
+}
+
+//loadMetrics reads the vertical metrics of the font at its rasterized size
+func (f *Font) loadMetrics() error {
+	var buf sfnt.Buffer
+	m, err := f.sfnt.Metrics(&buf, fixed.I(int(f.scale)), f.hinting)
+	if err != nil {
+		return err
+	}
+	f.metrics = m
 	return nil
 }
 
-//LoadTrueTypeFont builds OpenGL buffers and glyph textures based on a ttf file
+//kern returns the kerning adjustment in logical pixels between two runes in reading order, 0 if prev is not set
+func (f *Font) kern(prev, r rune) float32 {
+	if !f.kerning || prev == 0 || f.direction == TopToBottom || f.monospaced() {
+		return 0
+	}
+
+	//kerning pairs are stored in visual order, left glyph first
+	left, right := prev, r
+	if f.direction == RightToLeft {
+		left, right = r, prev
+	}
+
+	//faces keep scratch buffers and are not safe for concurrent use
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return float32(f.face.Kern(left, right)>>6) / f.pixelRatio()
+}
+
+//letterGap returns the letter spacing in pixels at the given scale, never moving the pen back past the previous glyph
+func (f *Font) letterGap(prevAdvance, scale float32) float32 {
+	if f.monospaced() {
+		return 0
+	}
+	gap := f.letterSpacing * scale
+	if gap < -prevAdvance {
+		gap = -prevAdvance
+	}
+	return gap
+}
+
+//verticalAdvance returns the vertical advance of a rune in 1/64 glyph pixels, the line height if the font has no vertical metrics
+func (f *Font) verticalAdvance(r rune) int {
+	if !f.vertical || f.ttf == nil {
+		return int(float32(f.metrics.Height) * f.pixelRatio())
+	}
+	v := f.ttf.VMetric(fixed.Int26_6(f.pixelSize()*64), f.ttf.Index(r))
+	//round to whole pixels like the hinted face does
+	return int((v.AdvanceHeight + 32) &^ 63)
+}
+
+//leftBearing returns the distance from the pen to the left edge of the ink of r in glyph pixels,
+//negative when the glyph reaches left of the pen, without rasterizing it
+func (f *Font) leftBearing(r rune) (int, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bounds, _, ok := f.face.GlyphBounds(r)
+	if !ok {
+		return 0, false
+	}
+	return bounds.Min.X.Floor(), true
+}
+
+//underlineMetrics returns the offset of the top of the underline below the baseline and its thickness in pixels,
+//from the post table or a fraction of the font size if the font has none
+func (f *Font) underlineMetrics() (offset, thickness float32) {
+	post := f.sfnt.PostTable()
+	if post == nil || post.UnderlineThickness <= 0 {
+		size := float32(f.scale)
+		return size / 10, max32(size/14, 1)
+	}
+
+	units := float32(f.scale) / float32(f.sfnt.UnitsPerEm())
+	//the post table measures upwards, negative positions are below the baseline
+	return -float32(post.UnderlinePosition) * units, max32(float32(post.UnderlineThickness)*units, 1)
+}
+
+//strikethroughOffset returns the height of the strikethrough above the baseline in pixels,
+//the middle of the x-height or half the ascent if the font does not tell its x-height
+func (f *Font) strikethroughOffset() float32 {
+	if f.metrics.XHeight > 0 {
+		return float32(f.metrics.XHeight) / 64 / 2
+	}
+	return float32(f.metrics.Ascent) / 64 / 2
+}
+
+//max32 returns the larger of a and b
+func max32(a, b float32) float32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+//nextTabStop returns the offset of the first tab stop after offset, both in pixels from the start of the line
+func (f *Font) nextTabStop(offset, scale float32) float32 {
+	//explicit stops first, past the last one tabs fall back to the tab width
+	for _, stop := range f.tabStops {
+		if stop*scale > offset {
+			return stop * scale
+		}
+	}
+
+	f.mu.Lock()
+	advance, ok := f.face.GlyphAdvance(' ')
+	f.mu.Unlock()
+
+	space := float32(advance>>6) / f.pixelRatio()
+	if !ok {
+		//half an em is a common width of a space
+		space = float32(f.scale) / 2
+	}
+
+	stop := space * scale * float32(f.tabWidth)
+	if stop <= 0 {
+		return offset
+	}
+	return float32(math.Floor(float64(offset/stop))+1) * stop
+}
+
+//lineHeight returns the distance between two baselines in pixels, ascent + descent + line gap
+func (f *Font) lineHeight() float32 {
+	return float32(f.metrics.Height) / 64
+}
+
+//lineAdvance returns the distance in pixels the pen moves down for a new line, the line height times the line spacing
+func (f *Font) lineAdvance() float32 {
+	return f.lineHeight() * f.lineSpacing
+}
+
+//LoadTrueTypeFont builds OpenGL buffers and a glyph atlas texture based on a ttf or otf file
+//Color glyph bitmaps embedded as PNGs in sbix or CBDT tables, like emoji, are drawn in their own colors
+//The program stays the caller's, it can be shared by many fonts and is not deleted when they are released
 func LoadTrueTypeFont(program uint32, r io.Reader, scale int32, low, high rune, dir Direction) (*Font, error) {
+	f, err := loadTrueTypeFont(program, r, scale, low, high, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	//count the font as a user of the program, besides the caller owning it
+	retainProgram(program)
+	return f, nil
+}
+
+//loadTrueTypeFont is LoadTrueTypeFont for callers that already acquired the program for the font
+func loadTrueTypeFont(program uint32, r io.Reader, scale int32, low, high rune, dir Direction) (*Font, error) {
 	data, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
 
-	// Read the truetype font.
-	ttf, err := truetype.Parse(data)
+	f, err := newFont(data, scale, dir)
+	if err != nil {
+		return nil, err
+	}
+	f.program = program //set shader program
+
+	var saved textureState
+	saved.save()
+	f.padding = 1
+	f.atlas = newAtlas(f.padding)
+	saved.restore()
+	err = f.GenerateGlyphs(low, high)
+	if err != nil {
+		return nil, err
+	}
+
+	f.newBuffers()
+
+	return f, nil
+}
+
+//newFont makes a Font of ttf or otf data with the default settings, its face and metrics,
+//without the OpenGL objects and glyphs loadTrueTypeFont adds
+func newFont(data []byte, scale int32, dir Direction) (*Font, error) {
+	ttf, sf, err := parseFont(data)
 	if err != nil {
 		return nil, err
 	}
 
 	//make Font stuct type
 	f := new(Font)
+	f.glyphCache = &glyphCache{refs: 1}
 	f.fontChar = make(map[rune]*character)
 	f.ttf = ttf
+	f.sfnt = sf
+	f.vertical = hasTable(data, "vmtx")
+	f.bitmaps = parseColorBitmaps(data, sf)
 	f.scale = scale
-	f.program = program            //set shader program
+	f.dpi = 72
+	f.hinting = font.HintingFull
 	f.SetColor(1.0, 1.0, 1.0, 1.0) //set default white
+	f.kerning = true
+	f.direction = dir
+	f.lineSpacing = 1.0
+	f.gamma = 1.0
+	f.tabWidth = 4
+	f.batchSize = 32
 
-	err = f.GenerateGlyphs(low, high)
+	f.face, err = f.newFace()
 	if err != nil {
 		return nil, err
 	}
 
+	err = f.loadMetrics()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+//newBuffers creates the vbo and vao the font draws its quads from
+func (f *Font) newBuffers() {
+	f.buffers = &buffers{users: 1}
+
 	// Configure VAO/VBO for texture quads
-	gl.GenVertexArrays(1, &f.vao)
 	gl.GenBuffers(1, &f.vbo)
-	gl.BindVertexArray(f.vao)
 	gl.BindBuffer(gl.ARRAY_BUFFER, f.vbo)
 
-	gl.BufferData(gl.ARRAY_BUFFER, 6*4*4, nil, gl.STATIC_DRAW)
+	//room for one glyph quad, Printf grows it as needed
+	f.vboSize = floatsPerGlyph * 4
+	gl.BufferData(gl.ARRAY_BUFFER, f.vboSize, nil, gl.DYNAMIC_DRAW)
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+
+	f.newVertexArray()
+}
+
+//Reload replaces the font data with a new ttf or otf font, keeping the program, buffers and settings.
+//The glyphs loaded so far are generated again from the new font.
+//If the new font cannot be read the old one stays in use and the error is returned.
+func (f *Font) Reload(r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	ttf, sf, err := parseFont(data)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	oldTTF, oldSfnt, oldVertical, oldBitmaps := f.ttf, f.sfnt, f.vertical, f.bitmaps
+	f.ttf, f.sfnt, f.vertical, f.bitmaps = ttf, sf, hasTable(data, "vmtx"), parseColorBitmaps(data, sf)
+	face, err := f.newFace()
+	if err == nil {
+		err = f.loadMetrics()
+	}
+	if err != nil {
+		f.ttf, f.sfnt, f.vertical, f.bitmaps = oldTTF, oldSfnt, oldVertical, oldBitmaps
+		f.mu.Unlock()
+		return err
+	}
+	f.face = face
+	f.mu.Unlock()
+
+	return f.regenerate(f.clearGlyphs())
+}
+
+//TTF returns the parsed font for reading tables, names and glyph metrics the package does not expose.
+//It is nil for OpenType fonts with CFF outlines. Do not modify it, a Reload replaces it.
+func (f *Font) TTF() *truetype.Font {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.ttf
+}
+
+//newVertexArray creates the vao feeding the quads in the vbo to the vert and vertTexCoord attributes of the font's program
+func (f *Font) newVertexArray() {
+	gl.GenVertexArrays(1, &f.vao)
+	gl.BindVertexArray(f.vao)
+	gl.BindBuffer(gl.ARRAY_BUFFER, f.vbo)
 
 	vertAttrib := uint32(gl.GetAttribLocation(f.program, gl.Str("vert\x00")))
 	gl.EnableVertexAttribArray(vertAttrib)
-	gl.VertexAttribPointer(vertAttrib, 2, gl.FLOAT, false, 4*4, gl.PtrOffset(0))
-	defer gl.DisableVertexAttribArray(vertAttrib)
+	gl.VertexAttribPointer(vertAttrib, 2, gl.FLOAT, false, floatsPerVertex*4, gl.PtrOffset(0))
 
 	texCoordAttrib := uint32(gl.GetAttribLocation(f.program, gl.Str("vertTexCoord\x00")))
 	gl.EnableVertexAttribArray(texCoordAttrib)
-	gl.VertexAttribPointer(texCoordAttrib, 2, gl.FLOAT, false, 4*4, gl.PtrOffset(2*4))
-	defer gl.DisableVertexAttribArray(texCoordAttrib)
+	gl.VertexAttribPointer(texCoordAttrib, 2, gl.FLOAT, false, floatsPerVertex*4, gl.PtrOffset(2*4))
 
-	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
 	gl.BindVertexArray(0)
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+}
 
-	return f, nil
+//parseFont reads font data as truetype and as sfnt, the truetype font is nil for OpenType fonts with CFF outlines
+func parseFont(data []byte) (*truetype.Font, *sfnt.Font, error) {
+	// Read the truetype font. This fails for OpenType fonts with CFF outlines, they are only read as sfnt.
+	ttf, ttfErr := truetype.Parse(data)
+
+	// Read it again as sfnt for the line gap.
+	sf, err := sfnt.Parse(data)
+	if err != nil {
+		if ttfErr != nil {
+			return nil, nil, ttfErr
+		}
+		return nil, nil, err
+	}
+	return ttf, sf, nil
+}
+
+//hasTable reports whether the sfnt data contains the table with the given tag, for collections the first font is checked
+func hasTable(data []byte, tag string) bool {
+	return findTable(data, tag) != nil
+}
+
+//findTable returns the table with the given tag from sfnt data, nil if it has none, for collections the first font is checked
+func findTable(data []byte, tag string) []byte {
+	u32 := func(i int) int {
+		return int(data[i])<<24 | int(data[i+1])<<16 | int(data[i+2])<<8 | int(data[i+3])
+	}
+
+	offset := 0
+	if len(data) >= 16 && string(data[:4]) == "ttcf" {
+		offset = u32(12)
+	}
+	if offset+12 > len(data) {
+		return nil
+	}
+
+	numTables := int(data[offset+4])<<8 | int(data[offset+5])
+	for i := 0; i < numTables; i++ {
+		record := offset + 12 + 16*i
+		if record+16 > len(data) {
+			return nil
+		}
+		if string(data[record:record+4]) == tag {
+			start, length := u32(record+8), u32(record+12)
+			if start+length > len(data) {
+				return nil
+			}
+			return data[start : start+length]
+		}
+	}
+	return nil
 }